@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/mailer"
+	"github.com/richiethie/BitDrop.Server/internal/oidc"
 	"github.com/richiethie/BitDrop.Server/internal/routes"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+	"github.com/richiethie/BitDrop.Server/internal/uploads"
+	"github.com/richiethie/BitDrop.Server/internal/utils"
 )
 
 func main() {
@@ -22,6 +30,34 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	if err := utils.InitJWTKeys(); err != nil {
+		log.Fatalf("Failed to initialize JWT keys: %v", err)
+	}
+
+	if err := services.InitMediaURLs(); err != nil {
+		log.Fatalf("Failed to initialize media URLs: %v", err)
+	}
+
+	if err := mailer.Init(); err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
+	if err := oidc.Init(); err != nil {
+		log.Fatalf("Failed to initialize login providers: %v", err)
+	}
+
+	if err := uploads.InitResumable(); err != nil {
+		log.Fatalf("Failed to initialize resumable uploads: %v", err)
+	}
+	if err := uploads.InitDirect(); err != nil {
+		log.Fatalf("Failed to initialize direct uploads: %v", err)
+	}
+	uploads.StartCleanup(context.Background(), 10*time.Minute)
+
 	// Create or open the log file in append mode
 	logFile, err := os.OpenFile("gin.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
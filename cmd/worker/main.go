@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/joho/godotenv"
+	"github.com/richiethie/BitDrop.Server/internal/account"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/jobs"
+	"github.com/richiethie/BitDrop.Server/internal/mailer"
+	"github.com/richiethie/BitDrop.Server/internal/processing"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+)
+
+// The worker runs background jobs (media processing, account deletion and exports) queued by the API server
+func main() {
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("No .env file found")
+	}
+
+	if err := db.Init(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// Export jobs email the download link
+	if err := mailer.Init(); err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
+	processing.RegisterHandlers()
+	account.RegisterHandlers()
+
+	concurrency, _ := strconv.Atoi(os.Getenv("WORKER_CONCURRENCY"))
+	if concurrency <= 0 {
+		concurrency = 2
+	}
+
+	// Stop claiming jobs on SIGINT/SIGTERM and let in-flight jobs finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs.Run(ctx, concurrency)
+	log.Println("Worker stopped")
+}
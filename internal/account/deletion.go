@@ -0,0 +1,177 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/jobs"
+	"github.com/richiethie/BitDrop.Server/internal/mailer"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/processing"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+)
+
+// Job kinds for account lifecycle work
+const (
+	JobDeleteAccount = "delete_account"
+	JobExportAccount = "export_account"
+	JobExpireExport  = "expire_export"
+)
+
+// ErrDeletionNotScheduled is returned when cancelling a deletion that isn't pending
+var ErrDeletionNotScheduled = errors.New("account deletion is not scheduled")
+
+type accountPayload struct {
+	UserID string `json:"user_id"`
+}
+
+// RegisterHandlers installs the account job handlers
+func RegisterHandlers() {
+	jobs.Register(JobDeleteAccount, jobs.Handler{Run: deleteAccount})
+	jobs.Register(JobExportAccount, jobs.Handler{Run: exportAccount, OnFailure: failExport})
+	jobs.Register(JobExpireExport, jobs.Handler{Run: expireExport})
+}
+
+// DeletionGracePeriod is how long a deleted account can still be restored
+// (ACCOUNT_DELETION_GRACE, default 14 days)
+func DeletionGracePeriod() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE")); err == nil && d >= 0 {
+		return d
+	}
+	return 14 * 24 * time.Hour
+}
+
+// ScheduleDeletion marks the account for deletion after the grace period and
+// queues the job that will hard-delete it. It returns when deletion will happen.
+func ScheduleDeletion(ctx context.Context, userID string) (time.Time, error) {
+	at := time.Now().Add(DeletionGracePeriod())
+	var email string
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			UPDATE users SET deletion_scheduled_at = $2 WHERE id = $1 RETURNING email
+		`, userID, at).Scan(&email)
+		if err != nil {
+			return err
+		}
+		// API keys stop working right away; sessions are revoked by the caller
+		if _, err := tx.Exec(ctx, `UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+			return err
+		}
+		return jobs.EnqueueAt(ctx, tx, JobDeleteAccount, accountPayload{UserID: userID}, at)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	err = mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Your BitDrop account will be deleted",
+		Body: fmt.Sprintf("We received a request to delete your BitDrop account.\n\nYour account and all of your drops will be permanently deleted on %s. To keep your account, log in before then and cancel the deletion from your settings.\n",
+			at.UTC().Format("January 2, 2006 at 15:04 UTC")),
+	})
+	if err != nil {
+		log.Printf("❌ Error sending deletion email: %v", err)
+	}
+	return at, nil
+}
+
+// CancelDeletion restores an account that's scheduled for deletion. The queued
+// job notices and does nothing.
+func CancelDeletion(ctx context.Context, userID string) error {
+	tag, err := db.DB.Exec(ctx, `
+		UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeletionNotScheduled
+	}
+	return nil
+}
+
+// deleteAccount hard-deletes a user whose grace period is over: their stored
+// media and exports first, then the database rows
+func deleteAccount(ctx context.Context, job *jobs.Job) error {
+	var payload accountPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+
+	var scheduledAt *time.Time
+	err := db.DB.QueryRow(ctx, `SELECT deletion_scheduled_at FROM users WHERE id = $1`, payload.UserID).Scan(&scheduledAt)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if scheduledAt == nil || scheduledAt.After(time.Now()) {
+		// Cancelled, or rescheduled by a later request with its own job
+		return nil
+	}
+
+	rows, err := db.DB.Query(ctx, `
+		SELECT id, video_key, thumbnail_key, preview_key, thumbnail_candidate_keys, media_private
+		FROM drops WHERE user_id = $1
+	`, payload.UserID)
+	if err != nil {
+		return err
+	}
+	var drops []models.Drop
+	for rows.Next() {
+		var d models.Drop
+		if err := rows.Scan(&d.ID, &d.VideoKey, &d.ThumbnailKey, &d.PreviewKey, &d.ThumbnailCandidateKeys, &d.MediaPrivate); err != nil {
+			rows.Close()
+			return err
+		}
+		drops = append(drops, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range drops {
+		processing.DeleteDropObjects(ctx, &drops[i])
+	}
+	for _, p := range userPrefixes(payload.UserID) {
+		if err := storage.DeletePrefix(ctx, p.store, p.prefix); err != nil {
+			log.Println("Failed to delete objects under", p.prefix, err)
+		}
+	}
+
+	err = pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM drops WHERE user_id = $1`, payload.UserID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, payload.UserID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("🗑️ Deleted account %s (%d drops)", payload.UserID, len(drops))
+	return nil
+}
+
+type storagePrefix struct {
+	store  storage.ObjectStore
+	prefix string
+}
+
+// userPrefixes are the storage prefixes holding per-user objects outside drops
+func userPrefixes(userID string) []storagePrefix {
+	return []storagePrefix{
+		{storage.Private, exportPrefix(userID)},
+		{storage.Default, services.AvatarPrefix(userID)},
+	}
+}
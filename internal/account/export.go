@@ -0,0 +1,347 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/jobs"
+	"github.com/richiethie/BitDrop.Server/internal/mailer"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+	"github.com/richiethie/BitDrop.Server/internal/utils"
+)
+
+// Export statuses
+const (
+	ExportStatusPending = "pending"
+	ExportStatusReady   = "ready"
+	ExportStatusFailed  = "failed"
+	ExportStatusExpired = "expired"
+)
+
+var (
+	// ErrExportNotFound is returned for exports that don't exist or belong to someone else
+	ErrExportNotFound = errors.New("export not found")
+	// ErrExportUnavailable is returned when downloading an export that isn't
+	// ready, has expired, or with the wrong token
+	ErrExportUnavailable = errors.New("export is not available")
+)
+
+// Export is a ZIP archive of everything we hold about a user
+type Export struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Size        int64      `json:"size"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+type exportPayload struct {
+	ExportID string `json:"export_id"`
+}
+
+// ExportLinkTTL is how long a finished export can be downloaded (EXPORT_LINK_TTL, default 48h)
+func ExportLinkTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("EXPORT_LINK_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 48 * time.Hour
+}
+
+func exportPrefix(userID string) string {
+	return "exports/" + userID + "/"
+}
+
+// RequestExport queues an export of the user's data, or returns the one
+// already in progress
+func RequestExport(ctx context.Context, userID string) (*Export, error) {
+	var e Export
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			SELECT id, status, size, created_at, completed_at, expires_at
+			FROM account_exports WHERE user_id = $1 AND status = $2
+		`, userID, ExportStatusPending).Scan(&e.ID, &e.Status, &e.Size, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt)
+		if err == nil || err != pgx.ErrNoRows {
+			return err
+		}
+
+		e = Export{ID: uuid.NewString(), Status: ExportStatusPending, CreatedAt: time.Now()}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO account_exports (id, user_id, status, created_at) VALUES ($1, $2, $3, $4)
+		`, e.ID, userID, e.Status, e.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return jobs.Enqueue(ctx, tx, JobExportAccount, exportPayload{ExportID: e.ID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// GetExport returns one of the user's exports
+func GetExport(ctx context.Context, userID, exportID string) (*Export, error) {
+	var e Export
+	err := db.DB.QueryRow(ctx, `
+		SELECT id, status, size, created_at, completed_at, expires_at
+		FROM account_exports WHERE id = $1 AND user_id = $2
+	`, exportID, userID).Scan(&e.ID, &e.Status, &e.Size, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// OpenExport checks a download token and opens the export archive. The
+// caller closes the reader.
+func OpenExport(ctx context.Context, exportID, token string) (io.ReadCloser, int64, error) {
+	var key, tokenHash string
+	var size int64
+	err := db.DB.QueryRow(ctx, `
+		SELECT object_key, token_hash, size FROM account_exports
+		WHERE id = $1 AND status = $2 AND expires_at > NOW()
+	`, exportID, ExportStatusReady).Scan(&key, &tokenHash, &size)
+	if err == pgx.ErrNoRows || (err == nil && services.HashToken(token) != tokenHash) {
+		return nil, 0, ErrExportUnavailable
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	body, err := storage.Private.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, size, nil
+}
+
+// exportAccount builds the ZIP archive for an export, stores it and emails
+// the user a download link
+func exportAccount(ctx context.Context, job *jobs.Job) error {
+	var payload exportPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+
+	var userID, status, email string
+	err := db.DB.QueryRow(ctx, `
+		SELECT e.user_id, e.status, u.email
+		FROM account_exports e JOIN users u ON u.id = e.user_id
+		WHERE e.id = $1
+	`, payload.ExportID).Scan(&userID, &status, &email)
+	if err == pgx.ErrNoRows || (err == nil && status != ExportStatusPending) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := writeExportArchive(ctx, tmp, userID); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := exportPrefix(userID) + payload.ExportID + ".zip"
+	if err := storage.Private.Put(ctx, key, tmp, storage.PutOptions{ContentType: "application/zip", Size: size}); err != nil {
+		return err
+	}
+
+	token, err := services.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(ExportLinkTTL())
+	err = pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE account_exports
+			SET status = $2, object_key = $3, size = $4, token_hash = $5, completed_at = NOW(), expires_at = $6
+			WHERE id = $1
+		`, payload.ExportID, ExportStatusReady, key, size, services.HashToken(token), expiresAt)
+		if err != nil {
+			return err
+		}
+		return jobs.EnqueueAt(ctx, tx, JobExpireExport, payload, expiresAt)
+	})
+	if err != nil {
+		return err
+	}
+
+	link := utils.APIURL("/api/account/exports/" + payload.ExportID + "/download?token=" + token)
+	err = mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Your BitDrop data export is ready",
+		Body: fmt.Sprintf("Your BitDrop data export is ready to download:\n\n%s\n\nThe link expires on %s.\n",
+			link, expiresAt.UTC().Format("January 2, 2006 at 15:04 UTC")),
+	})
+	if err != nil {
+		// The archive is ready either way; don't rebuild it just to resend the email
+		log.Printf("❌ Error sending export email: %v", err)
+	}
+	log.Printf("📦 Export %s ready for user %s (%d bytes)", payload.ExportID, userID, size)
+	return nil
+}
+
+// writeExportArchive writes the user's profile, linked identities, drop
+// metadata and media into a ZIP archive
+func writeExportArchive(ctx context.Context, w io.Writer, userID string) error {
+	zw := zip.NewWriter(w)
+
+	documents := []struct {
+		name  string
+		query string
+	}{
+		{"profile.json", `
+			SELECT row_to_json(u)::text FROM (
+				SELECT id, email, email_verified, username, display_name, avatar_url, bio, tier, boosts_left, created_at, last_active
+				FROM users WHERE id = $1
+			) u`},
+		{"identities.json", `
+			SELECT COALESCE(json_agg(i ORDER BY i.created_at), '[]')::text FROM (
+				SELECT provider, email, created_at, last_login_at FROM identities WHERE user_id = $1
+			) i`},
+		{"sessions.json", `
+			SELECT COALESCE(json_agg(s ORDER BY s.created_at), '[]')::text FROM (
+				SELECT device_name, user_agent, ip, created_at, last_seen_at, revoked_at FROM sessions WHERE user_id = $1
+			) s`},
+		{"drops.json", `
+			SELECT COALESCE(json_agg(d ORDER BY d.created_at), '[]')::text FROM drops d WHERE d.user_id = $1`},
+	}
+	for _, doc := range documents {
+		var data string
+		if err := db.DB.QueryRow(ctx, doc.query, userID).Scan(&data); err != nil {
+			return fmt.Errorf("failed to export %s: %w", doc.name, err)
+		}
+		f, err := zw.Create(doc.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, data); err != nil {
+			return err
+		}
+	}
+
+	rows, err := db.DB.Query(ctx, `SELECT id, video_key, thumbnail_key, media_private FROM drops WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	type media struct {
+		name, key string
+		private   bool
+	}
+	var files []media
+	for rows.Next() {
+		var id uuid.UUID
+		var videoKey, thumbKey string
+		var private bool
+		if err := rows.Scan(&id, &videoKey, &thumbKey, &private); err != nil {
+			rows.Close()
+			return err
+		}
+		if videoKey != "" {
+			files = append(files, media{"videos/" + id.String() + path.Ext(videoKey), videoKey, private})
+		}
+		if thumbKey != "" {
+			files = append(files, media{"thumbnails/" + id.String() + path.Ext(thumbKey), thumbKey, private})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range files {
+		if err := copyObjectToZip(ctx, zw, storage.For(m.private), m.name, m.key); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				log.Println("Export skipping missing object", m.key)
+				continue
+			}
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// copyObjectToZip streams a stored object into the archive. Media is already
+// compressed, so it's stored rather than deflated.
+func copyObjectToZip(ctx context.Context, zw *zip.Writer, store storage.ObjectStore, name, key string) error {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, body)
+	return err
+}
+
+// failExport marks an export whose job exhausted its retries
+func failExport(ctx context.Context, job *jobs.Job, err error) {
+	var payload exportPayload
+	if json.Unmarshal(job.Payload, &payload) != nil {
+		return
+	}
+	_, dbErr := db.DB.Exec(ctx, `UPDATE account_exports SET status = $2 WHERE id = $1`, payload.ExportID, ExportStatusFailed)
+	if dbErr != nil {
+		log.Printf("Failed to mark export %s failed: %v", payload.ExportID, dbErr)
+	}
+}
+
+// expireExport deletes an export archive once its link has expired
+func expireExport(ctx context.Context, job *jobs.Job) error {
+	var payload exportPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+
+	var key string
+	err := db.DB.QueryRow(ctx, `
+		SELECT object_key FROM account_exports WHERE id = $1 AND status = $2
+	`, payload.ExportID, ExportStatusReady).Scan(&key)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := storage.Private.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+		return err
+	}
+	_, err = db.DB.Exec(ctx, `
+		UPDATE account_exports SET status = $2, token_hash = '' WHERE id = $1
+	`, payload.ExportID, ExportStatusExpired)
+	return err
+}
@@ -6,11 +6,24 @@ import (
 	"os"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var DB *pgxpool.Pool
 
+// Execer is satisfied by both the pool and a transaction, so helpers can run
+// either standalone or as part of a caller's transaction
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Querier is the read counterpart of Execer
+type Querier interface {
+	Execer
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 func Init() error {
 	fmt.Println("🔌 Attempting to connect to database...")
 
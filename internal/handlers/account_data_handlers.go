@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/richiethie/BitDrop.Server/internal/account"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+)
+
+// DeleteAccountHandler schedules the caller's account for deletion and logs
+// them out everywhere. Accounts with a password must confirm it.
+func DeleteAccountHandler(c *gin.Context) {
+	var req models.DeleteAccountRequest
+	// The body is optional for accounts without a password
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	userID := c.GetString("userId")
+	err := services.CheckPassword(c.Request.Context(), userID, req.Password)
+	if err == services.ErrWrongPassword {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Incorrect password"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error checking password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	at, err := account.ScheduleDeletion(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Error scheduling account deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	if _, err := services.RevokeOtherSessions(c.Request.Context(), userID, ""); err != nil {
+		log.Printf("❌ Error revoking sessions: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":               "Account scheduled for deletion",
+		"deletion_scheduled_at": at,
+	})
+}
+
+// RestoreAccountHandler cancels a pending deletion of the caller's account
+func RestoreAccountHandler(c *gin.Context) {
+	err := account.CancelDeletion(c.Request.Context(), c.GetString("userId"))
+	if err == account.ErrDeletionNotScheduled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is not scheduled for deletion"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error cancelling account deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Account restored"})
+}
+
+// RequestExportHandler starts building an archive of the caller's data. The
+// download link is emailed when it's ready.
+func RequestExportHandler(c *gin.Context) {
+	export, err := account.RequestExport(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		log.Printf("❌ Error requesting export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+		return
+	}
+	c.JSON(http.StatusAccepted, export)
+}
+
+// GetExportHandler reports the status of one of the caller's exports
+func GetExportHandler(c *gin.Context) {
+	if _, err := uuid.Parse(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+
+	export, err := account.GetExport(c.Request.Context(), c.GetString("userId"), c.Param("id"))
+	if err == account.ErrExportNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error fetching export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch export"})
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
+
+// DownloadExportHandler streams a finished export. The token from the emailed
+// link is the only credential, so the link works outside the app.
+func DownloadExportHandler(c *gin.Context) {
+	if _, err := uuid.Parse(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+
+	body, size, err := account.OpenExport(c.Request.Context(), c.Param("id"), c.Query("token"))
+	if err == account.ErrExportUnavailable {
+		c.JSON(http.StatusNotFound, gin.H{"error": "This download link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error opening export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download export"})
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, size, "application/zip", body, map[string]string{
+		"Content-Disposition": `attachment; filename="bitdrop-export.zip"`,
+	})
+}
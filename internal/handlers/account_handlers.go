@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+)
+
+// ForgotPasswordHandler emails a reset link if the address belongs to an
+// account. It answers the same either way so it can't be used to probe emails.
+func ForgotPasswordHandler(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var userID, email string
+	err := db.DB.QueryRow(c.Request.Context(), `
+		SELECT id, email FROM users WHERE email = $1
+	`, strings.ToLower(req.Email)).Scan(&userID, &email)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Printf("❌ Error looking up user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err == nil {
+		if err := services.SendPasswordResetEmail(c.Request.Context(), userID, email); err != nil {
+			log.Printf("❌ Error sending password reset email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If that email has an account, a reset link is on its way"})
+}
+
+// ResetPasswordHandler sets a new password using an emailed reset token
+func ResetPasswordHandler(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := services.ResetPassword(c.Request.Context(), req.Token, req.Password)
+	if err == services.ErrInvalidUserToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error resetting password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated. Please log in again."})
+}
+
+// VerifyEmailHandler confirms an email address using an emailed token
+func VerifyEmailHandler(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := services.VerifyEmail(c.Request.Context(), req.Token)
+	if err == services.ErrInvalidUserToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error verifying email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerificationHandler sends the caller a fresh verification email
+func ResendVerificationHandler(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	var email string
+	var verified bool
+	err := db.DB.QueryRow(c.Request.Context(), `
+		SELECT email, email_verified FROM users WHERE id = $1
+	`, userID).Scan(&email, &verified)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if verified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	if err := services.SendVerificationEmail(c.Request.Context(), userID, email); err != nil {
+		log.Printf("❌ Error sending verification email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+)
+
+// ListAPIKeysHandler returns the caller's API keys (without the secrets)
+func ListAPIKeysHandler(c *gin.Context) {
+	keys, err := services.ListAPIKeys(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		log.Printf("❌ Error listing API keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// CreateAPIKeyHandler issues a new API key. The key itself is only shown in this response.
+func CreateAPIKeyHandler(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	raw, key, err := services.CreateAPIKey(c.Request.Context(), c.GetString("userId"), req.Name, req.Scopes, expiresAt)
+	switch err {
+	case nil:
+		c.JSON(http.StatusCreated, gin.H{"key": raw, "api_key": key})
+	case services.ErrInvalidScope:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope"})
+	case services.ErrTooManyAPIKeys:
+		c.JSON(http.StatusConflict, gin.H{"error": "You have too many API keys, revoke one first"})
+	default:
+		log.Printf("❌ Error creating API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+	}
+}
+
+// RevokeAPIKeyHandler revokes one of the caller's API keys
+func RevokeAPIKeyHandler(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	err = services.RevokeAPIKey(c.Request.Context(), c.GetString("userId"), id)
+	if err == services.ErrAPIKeyNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error revoking API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
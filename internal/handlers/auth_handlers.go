@@ -4,7 +4,9 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +15,7 @@ import (
 
 	"github.com/richiethie/BitDrop.Server/internal/db"
 	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/services"
 	"github.com/richiethie/BitDrop.Server/internal/utils"
 )
 
@@ -58,10 +61,13 @@ func SignUp(c *gin.Context) {
 
 	fmt.Printf("🚀 Inserting user: %s %s\n", req.Username, req.Email)
 
-	_, err = db.DB.Exec(context.Background(), `
+	var userID string
+	email := strings.ToLower(req.Email)
+	err = db.DB.QueryRow(context.Background(), `
 		INSERT INTO users (id, username, email, password, avatar_url, bio, tier, boosts_left, is_admin, created_at, last_active)
 		VALUES (gen_random_uuid(), $1, $2, $3, '', '', 'free', 0, false, NOW(), NOW())
-	`, req.Username, strings.ToLower(req.Email), string(hashedPassword))
+		RETURNING id
+	`, req.Username, email, string(hashedPassword)).Scan(&userID)
 
 	if err != nil {
 		fmt.Printf("❌ Error creating user: %v\n", err)
@@ -70,6 +76,12 @@ func SignUp(c *gin.Context) {
 	}
 
 	fmt.Println("✅ User created successfully!")
+
+	// The account works without it, so a mail failure shouldn't fail signup
+	if err := services.SendVerificationEmail(c.Request.Context(), userID, email); err != nil {
+		fmt.Printf("❌ Error sending verification email: %v\n", err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully"})
 }
 
@@ -80,52 +92,254 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// 🔒 Refuse attempts while the account or IP is locked out
+	ip := c.ClientIP()
+	throttle, err := services.CheckLoginThrottle(c.Request.Context(), req.Email, ip)
+	if err != nil {
+		fmt.Printf("❌ Error checking login throttle: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if throttle.RetryAfter > 0 {
+		respondLoginLocked(c, throttle)
+		return
+	}
+
 	var storedHashedPassword string
 	var user models.User
 
-	err := db.DB.QueryRow(context.Background(), `
-		SELECT id, email, username, password, avatar_url, bio, tier, boosts_left, is_admin, created_at, last_active
+	row := db.DB.QueryRow(context.Background(), `
+		SELECT `+services.UserColumns+`, password
 		FROM users
 		WHERE email = $1
-	`, strings.ToLower(req.Email)).Scan(
-		&user.ID,
-		&user.Email,
-		&user.Username,
-		&storedHashedPassword,
-		&user.AvatarURL,
-		&user.Bio,
-		&user.Tier,
-		&user.BoostsLeft,
-		&user.IsAdmin,
-		&user.CreatedAt,
-		&user.LastActive,
-	)
+	`, strings.ToLower(req.Email))
+	err = services.ScanUser(row, &user, &storedHashedPassword)
+
+	if err == nil {
+		err = bcrypt.CompareHashAndPassword([]byte(storedHashedPassword), []byte(req.Password))
+	}
+	if err != nil {
+		// Unknown emails count too, so lockouts don't reveal which accounts exist
+		throttle, err := services.RecordLoginFailure(c.Request.Context(), req.Email, ip)
+		if err != nil {
+			fmt.Printf("❌ Error recording login failure: %v\n", err)
+		}
+		if throttle.RetryAfter > 0 {
+			respondLoginLocked(c, throttle)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":            "Invalid email or password",
+			"captcha_required": throttle.CaptchaRequired,
+		})
+		return
+	}
+
+	completeLogin(c, &user, req.DeviceName)
+}
+
+// respondLoginLocked tells the client to back off before trying to log in again
+func respondLoginLocked(c *gin.Context, throttle services.LoginThrottle) {
+	seconds := int(math.Ceil(throttle.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":            "Too many failed login attempts, please try again later",
+		"retry_after":      seconds,
+		"captcha_required": throttle.CaptchaRequired,
+	})
+}
+
+// completeLogin finishes a first-factor login: accounts with 2FA get a
+// challenge, everyone else gets a session. Failed login counts are only
+// cleared once the login is complete, so 2FA codes can't be guessed by
+// logging in again for a fresh challenge.
+func completeLogin(c *gin.Context, user *models.User, deviceName string) {
+	// ✅ Accounts with 2FA get a challenge instead of tokens
+	mfa, err := services.TOTPEnabled(c.Request.Context(), user.ID)
+	if err != nil {
+		fmt.Printf("❌ Error checking 2FA: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if mfa {
+		challenge, err := services.CreateMFAChallenge(c.Request.Context(), user.ID)
+		if err != nil {
+			fmt.Printf("❌ Error creating 2FA challenge: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+			"expires_in":      int(services.MFAChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	if err := services.ClearLoginFailures(c.Request.Context(), user.Email); err != nil {
+		fmt.Printf("❌ Error clearing login failures: %v\n", err)
+	}
+	respondWithSession(c, user, deviceName)
+}
+
+// LoginTOTP finishes a two-step login by exchanging the challenge token from
+// Login and a TOTP or recovery code for real tokens. Wrong codes count as
+// failed logins for the account and IP, like wrong passwords.
+func LoginTOTP(c *gin.Context) {
+	var req models.LoginTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	email, err := services.MFAChallengeEmail(c.Request.Context(), req.ChallengeToken)
+	if err == services.ErrInvalidUserToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Error loading 2FA challenge: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// 🔒 Refuse attempts while the account or IP is locked out
+	ip := c.ClientIP()
+	throttle, err := services.CheckLoginThrottle(c.Request.Context(), email, ip)
+	if err != nil {
+		fmt.Printf("❌ Error checking login throttle: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if throttle.RetryAfter > 0 {
+		respondLoginLocked(c, throttle)
+		return
+	}
+
+	userID, err := services.CompleteMFAChallenge(c.Request.Context(), req.ChallengeToken, req.Code)
+	if err == services.ErrInvalidUserToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+	if err == services.ErrInvalidTOTPCode || err == services.ErrTOTPNotEnrolled {
+		throttle, err := services.RecordLoginFailure(c.Request.Context(), email, ip)
+		if err != nil {
+			fmt.Printf("❌ Error recording login failure: %v\n", err)
+		}
+		if throttle.RetryAfter > 0 {
+			respondLoginLocked(c, throttle)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Error completing 2FA challenge: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	user, err := services.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+	if err := services.ClearLoginFailures(c.Request.Context(), email); err != nil {
+		fmt.Printf("❌ Error clearing login failures: %v\n", err)
+	}
+	respondWithSession(c, user, req.DeviceName)
+}
+
+// respondWithSession starts a session for user and responds with its tokens
+func respondWithSession(c *gin.Context, user *models.User, deviceName string) {
+	// ✅ Generate access and refresh tokens
+	refreshToken, sessionID, err := services.StartSession(c.Request.Context(), user.ID, clientInfo(c, deviceName))
+	if err != nil {
+		fmt.Printf("❌ Error starting session: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	token, err := utils.GenerateJWT(user.ID, user.Email, sessionID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
 
+	// ✅ Return tokens and user
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL().Seconds()),
+		"user":          user,
+	})
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token can be used once.
+func RefreshToken(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	userID, sessionID, refreshToken, err := services.RotateRefreshToken(c.Request.Context(), req.RefreshToken)
+	if err == services.ErrInvalidRefreshToken || err == services.ErrRefreshTokenReused {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		fmt.Printf("❌ Error rotating refresh token: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(storedHashedPassword), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	var email string
+	err = db.DB.QueryRow(c.Request.Context(), `SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	// ✅ Generate JWT
-	token, err := utils.GenerateJWT(user.ID, user.Email)
+	if err := services.TouchSession(c.Request.Context(), sessionID, clientInfo(c, "")); err != nil {
+		fmt.Printf("❌ Error updating session: %v\n", err)
+	}
+
+	token, err := utils.GenerateJWT(userID, email, sessionID.String())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	// ✅ Return token and user
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL().Seconds()),
 	})
 }
 
+// clientInfo describes the device making the request
+func clientInfo(c *gin.Context, deviceName string) services.ClientInfo {
+	return services.ClientInfo{
+		DeviceName: strings.TrimSpace(deviceName),
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+	}
+}
+
+// Logout revokes the session the refresh token belongs to. This ends the
+// session immediately: AuthMiddleware rejects access tokens of revoked sessions.
 func Logout(c *gin.Context) {
-	// Optional: log logout events, audit logs, etc.
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if err := services.RevokeRefreshToken(c.Request.Context(), req.RefreshToken); err != nil {
+		fmt.Printf("❌ Error revoking refresh token: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
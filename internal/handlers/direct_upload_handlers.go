@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+	"github.com/richiethie/BitDrop.Server/internal/uploads"
+)
+
+// CreateUploadURLHandler reserves a drop and returns a short-lived URL the
+// client uploads the video to directly. The upload is staged in the private
+// store whatever the drop's visibility; FinalizeDropHandler inspects it and
+// creates the drop.
+func CreateUploadURLHandler(c *gin.Context) {
+	var req models.UploadURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	visibility, err := parseVisibility(req.Visibility)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	presigner, ok := storage.Private.(storage.Presigner)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Direct uploads are not supported by the storage backend"})
+		return
+	}
+	if req.Size > maxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload exceeds the maximum size"})
+		return
+	}
+
+	userIDVal, _ := c.Get("userId")
+	userIDStr, ok := userIDVal.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID in context"})
+		return
+	}
+	var groupID *uuid.UUID
+	if gid, err := uuid.Parse(req.GroupID); err == nil {
+		groupID = &gid
+	}
+
+	stagingKey := uploads.DirectStagingKey()
+	upload, err := presigner.PresignPut(c.Request.Context(), stagingKey, req.ContentType, uploads.DirectUploadTTL())
+	if err != nil {
+		log.Println("Failed to presign upload:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload URL"})
+		return
+	}
+
+	pending, err := uploads.CreateDirectUpload(c.Request.Context(), userIDStr, stagingKey, req.Caption, visibility, groupID, upload.ExpiresAt)
+	if err != nil {
+		log.Println("Failed to record direct upload:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload URL"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"drop_id": pending.ID,
+		"upload":  upload,
+	})
+}
+
+// FinalizeDropHandler creates the drop for a completed direct upload
+func FinalizeDropHandler(c *gin.Context) {
+	userIDVal, _ := c.Get("userId")
+	pending, err := uploads.GetDirectUpload(c.Request.Context(), c.Param("id"))
+	if err == uploads.ErrUploadNotFound && dropExists(c, c.Param("id"), c.GetString("userId")) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload has already been finalized"})
+		return
+	}
+	if err == uploads.ErrUploadNotFound || (err == nil && pending.UserID != userIDVal) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Failed to load direct upload:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	userID, err := uuid.Parse(pending.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID is not a valid UUID"})
+		return
+	}
+
+	info, err := storage.Private.Stat(c.Request.Context(), pending.StagingKey)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusConflict, gin.H{"error": "Video has not been uploaded yet"})
+		return
+	}
+	if err != nil {
+		log.Println("Failed to stat uploaded video:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify upload"})
+		return
+	}
+	if info.Size > maxUploadSize {
+		_ = storage.Private.Delete(context.Background(), pending.StagingKey)
+		_ = pending.Delete(context.Background())
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload exceeds the maximum size"})
+		return
+	}
+
+	// Inspection needs a local copy of the video
+	tmpVideoPath, err := storage.DownloadToTemp(c.Request.Context(), storage.Private, pending.StagingKey)
+	if err != nil {
+		log.Println("Failed to download uploaded video:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read uploaded video"})
+		return
+	}
+	defer os.Remove(tmpVideoPath)
+
+	meta, err := inspectVideo(c.Request.Context(), userID, tmpVideoPath)
+	if err != nil {
+		var invalid errInvalidVideo
+		if errors.As(err, &invalid) {
+			_ = storage.Private.Delete(context.Background(), pending.StagingKey)
+			_ = pending.Delete(context.Background())
+		}
+		respondInspectError(c, err)
+		return
+	}
+
+	// The staged object keeps the Content-Type the client picked, so the drop
+	// gets its own copy. Each finalize stores its own, leaving the staged
+	// upload in place for a retry until a drop is created.
+	private := pending.Visibility != models.DropVisibilityPublic
+	videoKey, err := storeVideoFile(c.Request.Context(), tmpVideoPath, meta, private)
+	if err != nil {
+		log.Println("Failed to store uploaded video:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store video"})
+		return
+	}
+
+	// Claiming the pending record with the insert makes concurrent finalize
+	// calls safe: only one of them creates the drop
+	claim := func(tx pgx.Tx) error { return pending.Claim(c.Request.Context(), tx) }
+	drop, err := createDrop(c.Request.Context(), pending.ID, userID, pending.GroupID, pending.Caption, pending.Visibility, videoKey, private, meta, claim)
+	if err != nil {
+		_ = storage.For(private).Delete(context.Background(), videoKey)
+	}
+	if err == uploads.ErrUploadClaimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload has already been finalized"})
+		return
+	}
+	if err != nil {
+		log.Println("Failed to create drop:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create drop"})
+		return
+	}
+	if err := storage.Private.Delete(context.Background(), pending.StagingKey); err != nil && err != storage.ErrNotFound {
+		log.Println("Failed to delete staged upload:", err)
+	}
+	if !signDrops(c, drop) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, drop)
+}
+
+// dropExists reports whether userID has a drop with the given ID, i.e. the
+// direct upload it came from was already finalized
+func dropExists(c *gin.Context, dropID, userID string) bool {
+	id, err := uuid.Parse(dropID)
+	if err != nil {
+		return false
+	}
+	var exists bool
+	err = db.DB.QueryRow(c.Request.Context(), `SELECT EXISTS (SELECT 1 FROM drops WHERE id = $1 AND user_id = $2)`, id, userID).Scan(&exists)
+	return err == nil && exists
+}
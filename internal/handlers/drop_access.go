@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/rbac"
+)
+
+// Every read of another user's drops goes through visibleDropsCondition (for
+// lists) or canViewDrop (for a single drop). Both are built from dropViewer
+// so they agree.
+
+// errInvalidVisibility is returned by parseVisibility for unknown values
+var errInvalidVisibility = errors.New(`visibility must be "private", "public" or "shared"`)
+
+// parseVisibility validates a visibility from an upload. Drops are public
+// unless the uploader says otherwise.
+func parseVisibility(v string) (string, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == "" {
+		return models.DropVisibilityPublic, nil
+	}
+	if !models.ValidDropVisibility(v) {
+		return "", errInvalidVisibility
+	}
+	return v, nil
+}
+
+// dropViewer is what decides which drops the caller may see, shared by
+// visibleDropsCondition and canViewDrop
+type dropViewer struct {
+	userID string
+	// readAny is set for holders of drops:read:any, who see every drop
+	readAny bool
+	// groups are where the caller holds drops:read:any through a group role
+	groups []string
+}
+
+// viewerForRequest loads the caller's dropViewer
+func viewerForRequest(c *gin.Context) (*dropViewer, error) {
+	g, err := rbac.ForRequest(c)
+	if err != nil {
+		return nil, err
+	}
+	v := &dropViewer{userID: c.GetString("userId"), readAny: g.Has(rbac.DropsReadAny), groups: []string{}}
+	for _, id := range g.GroupsWith(rbac.DropsReadAny) {
+		v.groups = append(v.groups, id.String())
+	}
+	return v, nil
+}
+
+// condition returns a WHERE condition matching the drops (aliased alias) v
+// may see, reading its arguments from $firstArg and $firstArg+1
+func (v *dropViewer) condition(alias string, firstArg int) string {
+	return fmt.Sprintf(`(%[5]t
+		OR %[1]s.visibility = '%[2]s'
+		OR %[1]s.user_id = $%[4]d::uuid
+		OR %[1]s.group_id = ANY($%[6]d::uuid[])
+		OR (%[1]s.visibility = '%[3]s' AND EXISTS (
+			SELECT 1 FROM drop_shares s WHERE s.drop_id = %[1]s.id AND s.user_id = $%[4]d::uuid
+		)))`, alias, models.DropVisibilityPublic, models.DropVisibilityShared, firstArg, v.readAny, firstArg+1)
+}
+
+// args are the values to bind for condition
+func (v *dropViewer) args() []any {
+	// An empty viewer matches nobody's drops; uuid casts reject ''
+	userID := v.userID
+	if userID == "" {
+		userID = "00000000-0000-0000-0000-000000000000"
+	}
+	return []any{userID, v.groups}
+}
+
+// canView reports whether v may see drop; sharedWithViewer is whether drop is
+// on v's share list
+func (v *dropViewer) canView(drop *models.Drop, sharedWithViewer bool) bool {
+	switch {
+	case v.readAny, drop.Visibility == models.DropVisibilityPublic, drop.UserID.String() == v.userID:
+		return true
+	case drop.Visibility == models.DropVisibilityShared && sharedWithViewer:
+		return true
+	case drop.GroupID != nil:
+		return slices.Contains(v.groups, drop.GroupID.String())
+	}
+	return false
+}
+
+// visibleDropsCondition returns a WHERE condition matching the drops (aliased
+// alias) the caller may see, and the two arguments to bind for it starting at
+// $firstArg
+func visibleDropsCondition(c *gin.Context, alias string, firstArg int) (string, []any, error) {
+	v, err := viewerForRequest(c)
+	if err != nil {
+		return "", nil, err
+	}
+	return v.condition(alias, firstArg), v.args(), nil
+}
+
+// canViewDrop reports whether the caller may see drop: it's public, theirs,
+// shared with them, or they may read any drop in its group
+func canViewDrop(c *gin.Context, drop *models.Drop) (bool, error) {
+	v, err := viewerForRequest(c)
+	if err != nil {
+		return false, err
+	}
+	if v.canView(drop, false) {
+		return true, nil
+	}
+	if drop.Visibility != models.DropVisibilityShared {
+		return false, nil
+	}
+	var shared bool
+	err = db.DB.QueryRow(c.Request.Context(), `
+		SELECT EXISTS (SELECT 1 FROM drop_shares WHERE drop_id = $1 AND user_id = $2)
+	`, drop.ID, v.args()[0]).Scan(&shared)
+	if err != nil {
+		return false, err
+	}
+	return v.canView(drop, shared), nil
+}
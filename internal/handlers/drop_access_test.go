@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/richiethie/BitDrop.Server/internal/models"
+)
+
+var (
+	viewerID = uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	ownerID  = uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	groupA   = uuid.MustParse("aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+	groupB   = uuid.MustParse("bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb")
+)
+
+// visibilityDrop is a drop in a visibility test, and whether it's on
+// viewerID's share list
+type visibilityDrop struct {
+	name   string
+	drop   models.Drop
+	shared bool
+}
+
+func visibilityDrops() []visibilityDrop {
+	d := func(owner uuid.UUID, visibility string, group *uuid.UUID) models.Drop {
+		return models.Drop{ID: uuid.New(), UserID: owner, Visibility: visibility, GroupID: group}
+	}
+	return []visibilityDrop{
+		{"public", d(ownerID, models.DropVisibilityPublic, nil), false},
+		{"private", d(ownerID, models.DropVisibilityPrivate, nil), false},
+		{"own private", d(viewerID, models.DropVisibilityPrivate, nil), false},
+		{"shared with viewer", d(ownerID, models.DropVisibilityShared, nil), true},
+		{"shared with others", d(ownerID, models.DropVisibilityShared, nil), false},
+		{"private, shared list kept", d(ownerID, models.DropVisibilityPrivate, nil), true},
+		{"private in group A", d(ownerID, models.DropVisibilityPrivate, &groupA), false},
+		{"private in group B", d(ownerID, models.DropVisibilityPrivate, &groupB), false},
+	}
+}
+
+var visibilityViewers = []struct {
+	name   string
+	viewer dropViewer
+	// sees are the drops from visibilityDrops the viewer may see
+	sees []string
+}{
+	{"anonymous", dropViewer{groups: []string{}},
+		[]string{"public"}},
+	{"user", dropViewer{userID: viewerID.String(), groups: []string{}},
+		[]string{"public", "own private", "shared with viewer"}},
+	{"group A moderator", dropViewer{userID: viewerID.String(), groups: []string{groupA.String()}},
+		[]string{"public", "own private", "shared with viewer", "private in group A"}},
+	{"global moderator", dropViewer{userID: viewerID.String(), readAny: true, groups: []string{}},
+		[]string{"public", "private", "own private", "shared with viewer", "shared with others",
+			"private, shared list kept", "private in group A", "private in group B"}},
+}
+
+func TestDropViewerCanView(t *testing.T) {
+	for _, tt := range visibilityViewers {
+		t.Run(tt.name, func(t *testing.T) {
+			want := map[string]bool{}
+			for _, name := range tt.sees {
+				want[name] = true
+			}
+			for _, d := range visibilityDrops() {
+				shared := d.shared && tt.viewer.userID == viewerID.String()
+				if got := tt.viewer.canView(&d.drop, shared); got != want[d.name] {
+					t.Errorf("canView(%s) = %v, want %v", d.name, got, want[d.name])
+				}
+			}
+		})
+	}
+}
+
+// TestDropViewerConditionMatchesCanView runs the list condition against a
+// real database and checks it selects exactly the drops canView allows. It
+// needs TEST_DATABASE_URL.
+func TestDropViewerConditionMatchesCanView(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	// Temporary tables shadow the real ones for this connection only
+	_, err = conn.Exec(ctx, `
+		CREATE TEMP TABLE drops (id UUID PRIMARY KEY, user_id UUID NOT NULL, group_id UUID, visibility TEXT NOT NULL);
+		CREATE TEMP TABLE drop_shares (drop_id UUID NOT NULL, user_id UUID NOT NULL)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drops := visibilityDrops()
+	for _, d := range drops {
+		_, err := conn.Exec(ctx, `INSERT INTO drops (id, user_id, group_id, visibility) VALUES ($1, $2, $3, $4)`,
+			d.drop.ID, d.drop.UserID, d.drop.GroupID, d.drop.Visibility)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.shared {
+			if _, err := conn.Exec(ctx, `INSERT INTO drop_shares VALUES ($1, $2)`, d.drop.ID, viewerID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, tt := range visibilityViewers {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := conn.Query(ctx, `SELECT d.id FROM drops d WHERE `+tt.viewer.condition("d", 1), tt.viewer.args()...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			listed, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+			if err != nil {
+				t.Fatal(err)
+			}
+			inList := map[uuid.UUID]bool{}
+			for _, id := range listed {
+				inList[id] = true
+			}
+			for _, d := range drops {
+				shared := d.shared && tt.viewer.userID == viewerID.String()
+				if want := tt.viewer.canView(&d.drop, shared); inList[d.drop.ID] != want {
+					t.Errorf("%s: listed = %v, canView = %v", d.name, inList[d.drop.ID], want)
+				}
+			}
+		})
+	}
+}
@@ -1,51 +1,50 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/media"
 	"github.com/richiethie/BitDrop.Server/internal/models"
-	"github.com/richiethie/BitDrop.Server/internal/utils"
+	"github.com/richiethie/BitDrop.Server/internal/processing"
+	"github.com/richiethie/BitDrop.Server/internal/rbac"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+	"github.com/richiethie/BitDrop.Server/internal/uploads"
 )
 
-// UploadDropHandler handles video uploads and creates a Drop record
-func UploadDropHandler(c *gin.Context) {
-	// Parse multipart form
-	err := c.Request.ParseMultipartForm(100 << 20) // 100MB max
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form: " + err.Error()})
-		return
-	}
+// Maximum accepted size of an upload request body
+const maxUploadSize = 100 << 20 // 100MB
 
-	file, header, err := c.Request.FormFile("video")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Video file is required"})
-		return
-	}
-	defer file.Close()
+// Maximum size of a non-file form field such as the caption
+const maxFormFieldSize = 4 << 10
 
-	caption := c.PostForm("caption")
-	groupIDStr := c.PostForm("group_id")
-	var groupID *uuid.UUID
-	if groupIDStr != "" {
-		gid, err := uuid.Parse(groupIDStr)
-		if err == nil {
-			groupID = &gid
-		}
-	}
+// Maximum length of a client-chosen upload ID
+const maxUploadIDLength = 128
+
+// errStoreVideo marks upload failures on our side rather than the client's
+type errStoreVideo struct{ err error }
 
+func (e errStoreVideo) Error() string { return e.err.Error() }
+func (e errStoreVideo) Unwrap() error { return e.err }
+
+// UploadDropHandler handles video uploads and creates a Drop record.
+// The multipart body is streamed to the private object store as it arrives,
+// and teed to a temp file for ffprobe validation, so memory use does not grow
+// with the size of the video. Thumbnails are generated afterwards by the worker;
+// the drop is returned as "processing".
+func UploadDropHandler(c *gin.Context) {
 	// Get user ID from context (set by AuthMiddleware)
 	userIDVal, exists := c.Get("userId")
 	if !exists {
@@ -63,137 +62,326 @@ func UploadDropHandler(c *gin.Context) {
 		return
 	}
 
-	// Generate a unique filename for the video
-	ext := ""
-	if header != nil {
-		name := header.Filename
-		for i := len(name) - 1; i >= 0; i-- {
-			if name[i] == '.' {
-				ext = name[i:]
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form: " + err.Error()})
+		return
+	}
+
+	// Clients may pass their own upload ID to poll GetUploadProgressHandler.
+	// IDs are per user, so they can't be used to see or clobber other uploads.
+	uploadID := c.GetHeader("X-Upload-ID")
+	if uploadID == "" {
+		uploadID = uuid.New().String()
+	}
+	if len(uploadID) > maxUploadIDLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Upload-ID is too long"})
+		return
+	}
+	if err := uploads.Default.Start(userIDStr, uploadID, c.Request.ContentLength); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "An upload with this X-Upload-ID is already in progress"})
+		return
+	}
+	c.Header("X-Upload-ID", uploadID)
+
+	var caption, visibility, filename, tmpVideoPath string
+	var groupID *uuid.UUID
+	// The video is staged in the private store since the visibility may come
+	// after it; public drops get their copy once it has been inspected
+	defer func() {
+		if tmpVideoPath != "" {
+			os.Remove(tmpVideoPath)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			uploads.Default.Finish(userIDStr, uploadID, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form: " + err.Error()})
+			return
+		}
+
+		switch part.FormName() {
+		case "caption":
+			caption, err = readFormField(part)
+		case "visibility":
+			if visibility, err = readFormField(part); err == nil {
+				visibility, err = parseVisibility(visibility)
+			}
+		case "group_id":
+			var groupIDStr string
+			groupIDStr, err = readFormField(part)
+			if gid, parseErr := uuid.Parse(groupIDStr); parseErr == nil {
+				groupID = &gid
+			}
+		case "video":
+			if filename != "" {
+				err = errors.New("only one video may be uploaded per drop")
 				break
 			}
+			// Generate a unique filename for the video
+			filename = uuid.New().String() + filepath.Ext(part.FileName())
+			tmpVideoPath, err = streamVideoPart(c.Request.Context(), storage.Private, part, filename, userIDStr, uploadID)
+		}
+		part.Close()
+
+		if err != nil {
+			if filename != "" {
+				_ = storage.Private.Delete(context.Background(), filename)
+			}
+			uploads.Default.Finish(userIDStr, uploadID, err)
+			var maxErr *http.MaxBytesError
+			var storeErr errStoreVideo
+			switch {
+			case errors.As(err, &maxErr):
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Failed to upload video: " + err.Error()})
+			case errors.As(err, &storeErr):
+				log.Println("Failed to store upload:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store video"})
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to upload video: " + err.Error()})
+			}
+			return
 		}
 	}
-	filename := uuid.New().String() + ext
 
-	// Save uploaded video to a temp file
-	tmpVideoFile, err := os.CreateTemp("", "upload-*.mp4")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create temp video file: " + err.Error()})
+	if filename == "" {
+		uploads.Default.Finish(userIDStr, uploadID, errors.New("missing video"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Video file is required"})
 		return
 	}
-	defer os.Remove(tmpVideoFile.Name())
+	uploads.Default.Finish(userIDStr, uploadID, nil)
 
-	_, err = io.Copy(tmpVideoFile, file)
+	meta, err := inspectVideo(c.Request.Context(), userID, tmpVideoPath)
 	if err != nil {
-		tmpVideoFile.Close()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save temp video file: " + err.Error()})
+		_ = storage.Private.Delete(context.Background(), filename)
+		respondInspectError(c, err)
 		return
 	}
-	tmpVideoFile.Close()
 
-	// Log temp video file size
-	if fi, err := os.Stat(tmpVideoFile.Name()); err == nil {
-		log.Println("Temp video file size:", fi.Size())
-	} else {
-		log.Println("Could not stat temp video file:", err)
+	if visibility == "" {
+		visibility = models.DropVisibilityPublic
+	}
+	mediaPrivate := visibility != models.DropVisibilityPublic
+	videoKey := filename
+	if !mediaPrivate {
+		videoKey, err = storeVideoFile(c.Request.Context(), tmpVideoPath, meta, false)
+		_ = storage.Private.Delete(context.Background(), filename)
+		if err != nil {
+			log.Println("Failed to store public video:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store video"})
+			return
+		}
 	}
-
-	// Reopen the temp file for reading (for upload)
-	videoReader, err := os.Open(tmpVideoFile.Name())
+	drop, err := createDrop(c.Request.Context(), uuid.New(), userID, groupID, caption, visibility, videoKey, mediaPrivate, meta, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open temp video file: " + err.Error()})
+		_ = storage.For(mediaPrivate).Delete(context.Background(), videoKey)
+		log.Println("Failed to create drop:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create drop"})
 		return
 	}
-	defer videoReader.Close()
-
-	// Upload file to Supabase Storage 'drops' bucket
-	videoURL, err := utils.UploadToSupabase(videoReader, filename, "drops")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload video: " + err.Error()})
+	if !signDrops(c, drop) {
 		return
 	}
 
-	// Use a dedicated subdirectory for thumbnails
-	thumbDir := filepath.Join(os.TempDir(), "bitdrop_thumbs")
-	if err := os.MkdirAll(thumbDir, 0o755); err != nil {
-		log.Println("Failed to create thumbnail directory:", thumbDir, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create thumbnail directory: " + err.Error()})
-		return
+	c.JSON(http.StatusCreated, drop)
+}
+
+// createDrop inserts the drops row for a video already stored at videoKey
+// (in storage.Private if mediaPrivate) and validated by inspectVideo, and
+// queues its media processing. It is shared by every upload path. claim, if
+// set, runs first in the same transaction; when it fails nothing is created
+// and its error is returned as is. The stored video is left alone on failure;
+// the caller removes it if nothing else refers to it.
+func createDrop(ctx context.Context, dropID, userID uuid.UUID, groupID *uuid.UUID, caption, visibility, videoKey string, mediaPrivate bool, meta *media.Metadata, claim func(pgx.Tx) error) (*models.Drop, error) {
+	store := storage.For(mediaPrivate)
+	drop := models.Drop{
+		ID:           dropID,
+		UserID:       userID,
+		GroupID:      groupID,
+		VideoURL:     store.PublicURL(videoKey),
+		VideoKey:     videoKey,
+		Caption:      caption,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		Votes:        0,
+		Visibility:   visibility,
+		MediaPrivate: mediaPrivate,
+		Status:       models.DropStatusProcessing,
+		Duration:     meta.Duration,
+		Width:        meta.Width,
+		Height:       meta.Height,
+		Codec:        meta.Codec,
+		FPS:          meta.FPS,
+		Rotation:     meta.Rotation,
+		FileSize:     meta.Size,
 	}
-	thumbPath := filepath.Join(thumbDir, "thumb-"+uuid.New().String()+"-"+strconv.FormatInt(time.Now().UnixNano(), 10)+".jpg")
-	log.Println("Thumbnail output path:", thumbPath)
 
-	// If the file already exists, delete it and abort if removal fails
-	if _, err := os.Stat(thumbPath); err == nil {
-		log.Println("Thumbnail file already exists, removing:", thumbPath)
-		if err := os.Remove(thumbPath); err != nil {
-			log.Println("Failed to remove existing thumbnail file:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove existing thumbnail file: " + err.Error()})
-			return
+	// Insert the drop and its processing job together
+	var claimErr error
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		if claim != nil {
+			if claimErr = claim(tx); claimErr != nil {
+				return claimErr
+			}
+		}
+		_, err := tx.Exec(ctx,
+			`INSERT INTO drops (id, user_id, group_id, video_url, video_key, thumbnail, thumbnail_key, caption, created_at, updated_at, votes, status,
+			                    duration, width, height, codec, fps, rotation, file_size, visibility, media_private)
+			 VALUES ($1, $2, $3, $4, $5, '', '', $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`,
+			drop.ID, drop.UserID, drop.GroupID, drop.VideoURL, drop.VideoKey, drop.Caption, drop.CreatedAt, drop.UpdatedAt, drop.Votes, drop.Status,
+			drop.Duration, drop.Width, drop.Height, drop.Codec, drop.FPS, drop.Rotation, drop.FileSize, drop.Visibility, drop.MediaPrivate,
+		)
+		if err != nil {
+			return err
+		}
+		if mediaPrivate != (visibility != models.DropVisibilityPublic) {
+			// Stored before the visibility was known
+			if err := processing.EnqueueMoveMedia(ctx, tx, drop.ID); err != nil {
+				return err
+			}
 		}
+		return processing.EnqueueDrop(ctx, tx, drop.ID)
+	})
+	if claimErr != nil {
+		return nil, claimErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert drop: %w", err)
 	}
-	defer os.Remove(thumbPath)
+	return &drop, nil
+}
 
-	// Run ffmpeg to create the thumbnail
-	var ffmpegOut bytes.Buffer
-	cmd := exec.Command("ffmpeg", "-y", "-i", tmpVideoFile.Name(), "-ss", "00:00:01.000", "-vframes", "1", thumbPath)
-	cmd.Stderr = &ffmpegOut
-	err = cmd.Run()
-	log.Println("ffmpeg output:", ffmpegOut.String())
+// errInvalidVideo marks inspectVideo failures caused by the upload itself
+type errInvalidVideo struct{ msg string }
+
+func (e errInvalidVideo) Error() string { return e.msg }
+
+// inspectVideo probes the local copy of an upload and checks it against the
+// limits for the uploader's tier
+func inspectVideo(ctx context.Context, userID uuid.UUID, videoPath string) (*media.Metadata, error) {
+	meta, err := media.Probe(ctx, videoPath)
+	if err == media.ErrNotVideo {
+		return nil, errInvalidVideo{"Uploaded file is not a supported video"}
+	}
 	if err != nil {
-		log.Println("ffmpeg error:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate thumbnail: " + err.Error()})
-		return
+		return nil, err
 	}
 
-	// Log thumbnail file size
-	if thumbFi, err := os.Stat(thumbPath); err == nil {
-		log.Println("Thumbnail file size:", thumbFi.Size())
-	} else {
-		log.Println("Could not stat thumbnail file:", err)
+	var tier string
+	if err := db.DB.QueryRow(ctx, `SELECT tier FROM users WHERE id = $1`, userID).Scan(&tier); err != nil {
+		return nil, fmt.Errorf("failed to load user tier: %w", err)
 	}
+	if err := media.LimitsForTier(tier).Validate(meta); err != nil {
+		return nil, errInvalidVideo{err.Error()}
+	}
+	return meta, nil
+}
 
-	// Only now, open the file for upload
-	thumbReader, err := os.Open(thumbPath)
+// storeVideoFile uploads the inspected video at path to the store for its
+// visibility under a new key. The key's extension and the Content-Type come
+// from the probe result rather than from the client.
+func storeVideoFile(ctx context.Context, path string, meta *media.Metadata, private bool) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		log.Println("Failed to open generated thumbnail:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open generated thumbnail: " + err.Error()})
-		return
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
 	}
-	defer thumbReader.Close()
 
-	thumbFilename := "thumbnails/" + uuid.New().String() + ".jpg"
-	thumbURL, err := utils.UploadToSupabase(thumbReader, thumbFilename, "drops")
+	ext, contentType := meta.FileType()
+	key := uuid.New().String() + ext
+	err = storage.For(private).Put(ctx, key, f, storage.PutOptions{ContentType: contentType, Size: fi.Size()})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload thumbnail: " + err.Error()})
+		return "", fmt.Errorf("failed to store video: %w", err)
+	}
+	return key, nil
+}
+
+// respondInspectError writes the response for an inspectVideo error
+func respondInspectError(c *gin.Context, err error) {
+	var invalid errInvalidVideo
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": invalid.msg})
 		return
 	}
+	log.Println("Failed to inspect video:", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect video"})
+}
 
-	// Save Drop to DB
-	drop := models.Drop{
-		ID:        uuid.New(),
-		UserID:    userID,
-		GroupID:   groupID,
-		VideoURL:  videoURL,
-		Thumbnail: thumbURL,
-		Caption:   caption,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		Votes:     0,
-	}
-
-	_, err = db.DB.Exec(context.Background(),
-		`INSERT INTO drops (id, user_id, group_id, video_url, thumbnail, caption, created_at, updated_at, votes)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
-		drop.ID, drop.UserID, drop.GroupID, drop.VideoURL, drop.Thumbnail, drop.Caption, drop.CreatedAt, drop.UpdatedAt, drop.Votes,
-	)
+// readFormField reads a small non-file form value
+func readFormField(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize+1))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert drop: " + err.Error()})
-		return
+		return "", err
+	}
+	if len(value) > maxFormFieldSize {
+		return "", fmt.Errorf("form field %q is too large", part.FormName())
 	}
+	return string(value), nil
+}
 
-	c.JSON(http.StatusCreated, drop)
+// streamVideoPart copies the video part to store under key while
+// teeing it into a temp file for inspection, recording progress for the
+// user's uploadID as it goes. It returns the temp file path; the caller
+// removes it. Failures not caused by the client are errStoreVideo.
+func streamVideoPart(ctx context.Context, store storage.ObjectStore, part *multipart.Part, key, userID, uploadID string) (string, error) {
+	tmpVideoFile, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return "", errStoreVideo{fmt.Errorf("failed to create temp video file: %w", err)}
+	}
+	defer tmpVideoFile.Close()
+
+	src := &readErrRecorder{r: part}
+	progress := &uploads.ProgressReader{R: io.TeeReader(src, tmpVideoFile), OnRead: func(n int64) {
+		uploads.Default.Add(userID, uploadID, n)
+	}}
+
+	err = store.Put(ctx, key, progress, storage.PutOptions{
+		ContentType: part.Header.Get("Content-Type"),
+		Size:        -1,
+	})
+	if err != nil {
+		os.Remove(tmpVideoFile.Name())
+		if src.err != nil {
+			return "", fmt.Errorf("failed to read video: %w", src.err)
+		}
+		return "", errStoreVideo{fmt.Errorf("failed to store video: %w", err)}
+	}
+	return tmpVideoFile.Name(), nil
+}
+
+// readErrRecorder remembers the error of a failed read, to tell a broken
+// request body apart from a storage failure
+type readErrRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrRecorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// GetUploadProgressHandler reports progress for an upload started by the caller
+func GetUploadProgressHandler(c *gin.Context) {
+	progress, ok := uploads.Default.Get(c.GetString("userId"), c.Param("uploadId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	c.JSON(http.StatusOK, progress)
 }
 
 // GetUserDropsHandler returns all drops for the authenticated user
@@ -209,7 +397,7 @@ func GetUserDropsHandler(c *gin.Context) {
 		return
 	}
 	rows, err := db.DB.Query(context.Background(),
-		`SELECT id, user_id, group_id, video_url, thumbnail, caption, created_at, updated_at, votes, visibility
+		`SELECT `+selectDropColumns("")+`
 		 FROM drops WHERE user_id = $1 ORDER BY created_at DESC`, userIDStr)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drops: " + err.Error()})
@@ -220,39 +408,54 @@ func GetUserDropsHandler(c *gin.Context) {
 	drops := []models.Drop{}
 	for rows.Next() {
 		var d models.Drop
-		err := rows.Scan(&d.ID, &d.UserID, &d.GroupID, &d.VideoURL, &d.Thumbnail, &d.Caption, &d.CreatedAt, &d.UpdatedAt, &d.Votes, &d.Visibility)
+		err := scanDrop(rows, &d)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan drop: " + err.Error()})
 			return
 		}
 		drops = append(drops, d)
 	}
+	if !signDrops(c, dropPointers(drops)...) {
+		return
+	}
 	c.JSON(http.StatusOK, drops)
 }
 
-// Handler to get drop details with user info
+// Handler to get drop details with user info. Drops the caller can't see
+// are reported as missing, so their IDs can't be probed.
 func GetDropDetailsHandler(c *gin.Context) {
 	dropID := c.Param("id")
 	var drop models.Drop
 	var username, avatarURL string
-	err := db.DB.QueryRow(context.Background(),
-		`SELECT d.id, d.user_id, d.group_id, d.video_url, d.thumbnail, d.caption, d.created_at, d.updated_at, d.votes, d.visibility,
-		        u.username, u.avatar_url
+	row := db.DB.QueryRow(context.Background(),
+		`SELECT `+selectDropColumns("d")+`, u.username, u.avatar_url
 		 FROM drops d
 		 JOIN users u ON d.user_id = u.id
-		 WHERE d.id = $1`, dropID).
-		Scan(&drop.ID, &drop.UserID, &drop.GroupID, &drop.VideoURL, &drop.Thumbnail, &drop.Caption, &drop.CreatedAt, &drop.UpdatedAt, &drop.Votes, &drop.Visibility, &username, &avatarURL)
+		 WHERE d.id = $1`, dropID)
+	err := scanDrop(row, &drop, &username, &avatarURL)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Drop not found"})
 		return
 	}
+	allowed, err := canViewDrop(c, &drop)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Drop not found"})
+		return
+	}
+	if !signDrops(c, &drop) {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"drop": drop,
 		"user": gin.H{"id": drop.UserID, "username": username, "avatar_url": avatarURL},
 	})
 }
 
-// Handler to delete a drop by id (only if user is owner)
+// Handler to delete a drop by id (owner, or anyone allowed to delete any drop)
 func DeleteDropHandler(c *gin.Context) {
 	dropID := c.Param("id")
 	userIDVal, exists := c.Get("userId")
@@ -266,39 +469,88 @@ func DeleteDropHandler(c *gin.Context) {
 		return
 	}
 	log.Println("DeleteDropHandler dropID:", dropID)
-	// Check if drop exists and belongs to user, and get video/thumbnail URLs
-	var ownerID, videoURL, thumbURL string
-	err := db.DB.QueryRow(context.Background(), "SELECT user_id, video_url, thumbnail FROM drops WHERE id = $1", dropID).Scan(&ownerID, &videoURL, &thumbURL)
+	// Check if drop exists and belongs to user, and get its object keys
+	var drop models.Drop
+	row := db.DB.QueryRow(context.Background(), "SELECT "+selectDropColumns("")+" FROM drops WHERE id = $1", dropID)
+	err := scanDrop(row, &drop)
 	if err != nil {
 		log.Println("DB error:", err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Drop not found"})
 		return
 	}
-	if ownerID != userIDStr {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to delete this drop"})
+	allowed, err := rbac.OwnerOr(c, drop.UserID.String(), rbac.DropsDeleteAny, drop.GroupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
 		return
 	}
-	// Extract file paths from URLs (after /drops/)
-	getPath := func(url string) string {
-		idx := strings.Index(url, "/drops/")
-		if idx == -1 {
-			return ""
-		}
-		return url[idx+len("/drops/"):]
-	}
-	videoPath := getPath(videoURL)
-	thumbPath := getPath(thumbURL)
-	// Delete files from Supabase Storage
-	if videoPath != "" {
-		_ = utils.DeleteFromSupabase(videoPath, "drops")
-	}
-	if thumbPath != "" {
-		_ = utils.DeleteFromSupabase(thumbPath, "drops")
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to delete this drop"})
+		return
 	}
+	log.Println("Deleting drop", dropID, "as user", userIDStr)
+	processing.DeleteDropObjects(c.Request.Context(), &drop)
 	_, err = db.DB.Exec(context.Background(), "DELETE FROM drops WHERE id = $1", dropID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete drop: " + err.Error()})
 		return
 	}
 	c.Status(http.StatusNoContent)
-} 
\ No newline at end of file
+}
+
+// SelectThumbnailHandler lets the owner pick one of the drop's thumbnail candidates
+func SelectThumbnailHandler(c *gin.Context) {
+	var req models.SelectThumbnailRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Index == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var drop models.Drop
+	row := db.DB.QueryRow(c.Request.Context(), "SELECT "+selectDropColumns("")+" FROM drops WHERE id = $1", c.Param("id"))
+	if err := scanDrop(row, &drop); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Drop not found"})
+		return
+	}
+	allowed, err := rbac.OwnerOr(c, drop.UserID.String(), rbac.DropsUpdateAny, drop.GroupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to edit this drop"})
+		return
+	}
+	i := *req.Index
+	if i < 0 || i >= len(drop.ThumbnailCandidateKeys) || i >= len(drop.ThumbnailCandidates) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No such thumbnail candidate"})
+		return
+	}
+
+	drop.Thumbnail = drop.ThumbnailCandidates[i]
+	drop.ThumbnailKey = drop.ThumbnailCandidateKeys[i]
+	drop.UpdatedAt = time.Now()
+
+	// Recompute the placeholder so it matches the new thumbnail
+	if thumbPath, err := storage.DownloadToTemp(c.Request.Context(), storage.For(drop.MediaPrivate), drop.ThumbnailKey); err != nil {
+		log.Println("Failed to download thumbnail for placeholder:", err)
+	} else {
+		if hash, color, err := media.Placeholder(thumbPath); err != nil {
+			log.Println("Failed to compute placeholder:", err)
+		} else {
+			drop.BlurHash, drop.DominantColor = hash, color
+		}
+		os.Remove(thumbPath)
+	}
+
+	_, err = db.DB.Exec(c.Request.Context(),
+		`UPDATE drops SET thumbnail = $2, thumbnail_key = $3, blurhash = $4, dominant_color = $5, updated_at = $6 WHERE id = $1`,
+		drop.ID, drop.Thumbnail, drop.ThumbnailKey, drop.BlurHash, drop.DominantColor, drop.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update thumbnail: " + err.Error()})
+		return
+	}
+	if !signDrops(c, &drop) {
+		return
+	}
+	c.JSON(http.StatusOK, drop)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+)
+
+// dropColumns are the drops columns read by scanDrop, in scan order
+var dropColumns = []string{
+	"id", "user_id", "group_id",
+	"video_url", "video_key", "thumbnail", "thumbnail_key", "blurhash", "dominant_color",
+	"thumbnail_candidates", "thumbnail_candidate_keys",
+	"preview_url", "preview_key", "playlist_url", "playlist_key",
+	"caption", "created_at", "updated_at", "votes", "visibility", "status", "media_private",
+	"duration", "width", "height", "codec", "fps", "rotation", "file_size",
+}
+
+// selectDropColumns returns dropColumns for a SELECT list, qualified with
+// alias when the query joins other tables
+func selectDropColumns(alias string) string {
+	if alias == "" {
+		return strings.Join(dropColumns, ", ")
+	}
+	qualified := make([]string, len(dropColumns))
+	for i, col := range dropColumns {
+		qualified[i] = alias + "." + col
+	}
+	return strings.Join(qualified, ", ")
+}
+
+// scanDrop scans a row selected with selectDropColumns into d, followed by
+// any extra columns the query appended
+func scanDrop(row pgx.Row, d *models.Drop, extra ...any) error {
+	dest := []any{
+		&d.ID, &d.UserID, &d.GroupID,
+		&d.VideoURL, &d.VideoKey, &d.Thumbnail, &d.ThumbnailKey, &d.BlurHash, &d.DominantColor,
+		&d.ThumbnailCandidates, &d.ThumbnailCandidateKeys,
+		&d.PreviewURL, &d.PreviewKey, &d.PlaylistURL, &d.PlaylistKey,
+		&d.Caption, &d.CreatedAt, &d.UpdatedAt, &d.Votes, &d.Visibility, &d.Status, &d.MediaPrivate,
+		&d.Duration, &d.Width, &d.Height, &d.Codec, &d.FPS, &d.Rotation, &d.FileSize,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
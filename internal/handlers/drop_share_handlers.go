@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/processing"
+	"github.com/richiethie/BitDrop.Server/internal/rbac"
+)
+
+// Most users that can be added to a share list in one request
+const maxSharesPerRequest = 100
+
+// loadEditableDrop loads the drop in the :id param if the caller may edit it,
+// responding with an error otherwise
+func loadEditableDrop(c *gin.Context) (*models.Drop, bool) {
+	var drop models.Drop
+	row := db.DB.QueryRow(c.Request.Context(), "SELECT "+selectDropColumns("")+" FROM drops WHERE id = $1", c.Param("id"))
+	if err := scanDrop(row, &drop); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Drop not found"})
+		return nil, false
+	}
+	allowed, err := rbac.OwnerOr(c, drop.UserID.String(), rbac.DropsUpdateAny, drop.GroupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return nil, false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to edit this drop"})
+		return nil, false
+	}
+	return &drop, true
+}
+
+// UpdateDropVisibilityHandler changes who can see a drop. A drop's share list
+// is kept when it stops being shared, so sharing it again restores it.
+func UpdateDropVisibilityHandler(c *gin.Context) {
+	var req models.UpdateVisibilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	visibility := strings.ToLower(strings.TrimSpace(req.Visibility))
+	if !models.ValidDropVisibility(visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidVisibility.Error()})
+		return
+	}
+
+	drop, ok := loadEditableDrop(c)
+	if !ok {
+		return
+	}
+	// Media moves between the public and private stores in the background;
+	// until then it's served from where it is
+	ctx := c.Request.Context()
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			UPDATE drops SET visibility = $2, updated_at = NOW() WHERE id = $1 RETURNING updated_at
+		`, drop.ID, visibility).Scan(&drop.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if drop.MediaPrivate == (visibility != models.DropVisibilityPublic) {
+			return nil
+		}
+		return processing.EnqueueMoveMedia(ctx, tx, drop.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update visibility: " + err.Error()})
+		return
+	}
+	drop.Visibility = visibility
+	if !signDrops(c, drop) {
+		return
+	}
+	c.JSON(http.StatusOK, drop)
+}
+
+// ListDropSharesHandler returns the users a drop is shared with
+func ListDropSharesHandler(c *gin.Context) {
+	drop, ok := loadEditableDrop(c)
+	if !ok {
+		return
+	}
+	shares, err := dropShares(c, drop.ID)
+	if err != nil {
+		log.Printf("❌ Error listing drop shares: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shares"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"shares": shares})
+}
+
+// AddDropSharesHandler adds users, by username, to a drop's share list. The
+// list only grants access while the drop's visibility is "shared".
+func AddDropSharesHandler(c *gin.Context) {
+	var req models.ShareDropRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Usernames) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if len(req.Usernames) > maxSharesPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many usernames in one request"})
+		return
+	}
+	usernames := make([]string, len(req.Usernames))
+	for i, u := range req.Usernames {
+		usernames[i] = strings.ToLower(strings.TrimSpace(u))
+	}
+
+	drop, ok := loadEditableDrop(c)
+	if !ok {
+		return
+	}
+
+	rows, err := db.DB.Query(c.Request.Context(), `
+		SELECT id, LOWER(username) FROM users
+		WHERE LOWER(username) = ANY($1) AND deletion_scheduled_at IS NULL
+	`, usernames)
+	if err != nil {
+		log.Printf("❌ Error looking up users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share drop"})
+		return
+	}
+	found := map[string]uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share drop"})
+			return
+		}
+		found[username] = id
+	}
+	rows.Close()
+
+	var unknown []string
+	var userIDs []string
+	for _, u := range usernames {
+		id, ok := found[u]
+		if !ok {
+			unknown = append(unknown, u)
+			continue
+		}
+		if id != drop.UserID {
+			userIDs = append(userIDs, id.String())
+		}
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown usernames", "usernames": unknown})
+		return
+	}
+
+	_, err = db.DB.Exec(c.Request.Context(), `
+		INSERT INTO drop_shares (drop_id, user_id, created_at)
+		SELECT $1, unnest($2::uuid[]), NOW()
+		ON CONFLICT DO NOTHING
+	`, drop.ID, userIDs)
+	if err != nil {
+		log.Printf("❌ Error sharing drop: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share drop"})
+		return
+	}
+
+	shares, err := dropShares(c, drop.ID)
+	if err != nil {
+		log.Printf("❌ Error listing drop shares: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shares"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"shares": shares})
+}
+
+// RemoveDropShareHandler takes a user off a drop's share list
+func RemoveDropShareHandler(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return
+	}
+	drop, ok := loadEditableDrop(c)
+	if !ok {
+		return
+	}
+
+	tag, err := db.DB.Exec(c.Request.Context(), `
+		DELETE FROM drop_shares WHERE drop_id = $1 AND user_id = $2
+	`, drop.ID, userID)
+	if err != nil {
+		log.Printf("❌ Error removing drop share: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove share"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// dropShares lists the users a drop is shared with, oldest first
+func dropShares(c *gin.Context, dropID uuid.UUID) ([]models.DropShare, error) {
+	rows, err := db.DB.Query(c.Request.Context(), `
+		SELECT u.id, u.username, u.avatar_url, s.created_at
+		FROM drop_shares s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.drop_id = $1
+		ORDER BY s.created_at
+	`, dropID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []models.DropShare{}
+	for rows.Next() {
+		var s models.DropShare
+		if err := rows.Scan(&s.UserID, &s.Username, &s.AvatarURL, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/processing"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+)
+
+// Largest HLS playlist the media proxy will rewrite
+const maxPlaylistSize = 1 << 20
+
+// signDrops swaps in signed media URLs for drops with private media,
+// responding with an error if they can't be signed
+func signDrops(c *gin.Context, drops ...*models.Drop) bool {
+	if err := services.SignDropMedia(c.Request.Context(), drops...); err != nil {
+		log.Printf("❌ Error signing media URLs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign media URLs"})
+		return false
+	}
+	return true
+}
+
+// dropPointers returns pointers into drops, for signing them in place
+func dropPointers(drops []models.Drop) []*models.Drop {
+	ptrs := make([]*models.Drop, len(drops))
+	for i := range drops {
+		ptrs[i] = &drops[i]
+	}
+	return ptrs
+}
+
+// HLSProxyHandler serves the HLS output of a drop to holders of a signed
+// playlist URL. Playlists are rewritten so the files they reference carry the
+// same signature; everything else redirects to a short-lived storage URL.
+func HLSProxyHandler(c *gin.Context) {
+	dropID, err := uuid.Parse(c.Param("id"))
+	if err != nil || !services.VerifyHLSSignature(dropID, c.Query("expires"), c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired media URL"})
+		return
+	}
+	file := strings.TrimPrefix(c.Param("file"), "/")
+	if file == "" || strings.Contains(file, "..") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	var videoKey string
+	var private bool
+	err = db.DB.QueryRow(c.Request.Context(), `SELECT video_key, media_private FROM drops WHERE id = $1`, dropID).
+		Scan(&videoKey, &private)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Drop not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load drop"})
+		return
+	}
+
+	key := processing.HLSPrefix(videoKey) + file
+	c.Header("Cache-Control", "private, no-store")
+	if !private {
+		// Made public since the URL was signed
+		c.Redirect(http.StatusFound, storage.Default.PublicURL(key))
+		return
+	}
+
+	if path.Ext(file) == ".m3u8" {
+		body, err := storage.Private.Get(c.Request.Context(), key)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read playlist"})
+			return
+		}
+		defer body.Close()
+		data, err := io.ReadAll(io.LimitReader(body, maxPlaylistSize))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read playlist"})
+			return
+		}
+		query := url.Values{"expires": {c.Query("expires")}, "signature": {c.Query("signature")}}.Encode()
+		c.Data(http.StatusOK, "application/vnd.apple.mpegurl", signPlaylist(data, query))
+		return
+	}
+
+	urls, err := storage.Private.(storage.URLSigner).SignURLs(c.Request.Context(), []string{key}, services.MediaURLTTL())
+	if err != nil || urls[0] == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign media URL"})
+		return
+	}
+	c.Redirect(http.StatusFound, urls[0])
+}
+
+// signPlaylist appends query to every URI line of an HLS playlist. The URIs
+// stay relative, so players resolve them back through the proxy.
+func signPlaylist(data []byte, query string) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			sep := "?"
+			if strings.Contains(line, "?") {
+				sep = "&"
+			}
+			line += sep + query
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestSignPlaylist(t *testing.T) {
+	const query = "expires=1700000000&signature=abc"
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "master playlist",
+			in: "#EXTM3U\n#EXT-X-VERSION:3\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n360p/index.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720\n720p/index.m3u8\n",
+			want: "#EXTM3U\n#EXT-X-VERSION:3\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n360p/index.m3u8?" + query + "\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720\n720p/index.m3u8?" + query + "\n",
+		},
+		{
+			name: "media playlist",
+			in:   "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4.0,\nsegment_000.ts\n#EXTINF:2.5,\nsegment_001.ts\n#EXT-X-ENDLIST\n",
+			want: "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4.0,\nsegment_000.ts?" + query + "\n#EXTINF:2.5,\nsegment_001.ts?" + query + "\n#EXT-X-ENDLIST\n",
+		},
+		{
+			name: "URI with a query",
+			in:   "segment_000.ts?v=2\n",
+			want: "segment_000.ts?v=2&" + query + "\n",
+		},
+		{
+			name: "CRLF and blank lines",
+			in:   "#EXTM3U\r\n\r\n  segment_000.ts  \r\n",
+			want: "#EXTM3U\n\nsegment_000.ts?" + query + "\n",
+		},
+		{
+			name: "empty",
+			in:   "",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(signPlaylist([]byte(tt.in), query)); got != tt.want {
+				t.Errorf("signPlaylist =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHLSProxyRejectsBadSignatures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/media/drops/:id/hls/*file", HLSProxyHandler)
+
+	dropID := uuid.NewString()
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	past := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"no signature", "/api/media/drops/" + dropID + "/hls/master.m3u8"},
+		{"forged signature", "/api/media/drops/" + dropID + "/hls/master.m3u8?expires=" + future + "&signature=deadbeef"},
+		{"expired", "/api/media/drops/" + dropID + "/hls/master.m3u8?expires=" + past + "&signature=deadbeef"},
+		{"invalid drop ID", "/api/media/drops/not-a-uuid/hls/master.m3u8?expires=" + future + "&signature=deadbeef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", w.Code)
+			}
+		})
+	}
+}
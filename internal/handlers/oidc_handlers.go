@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/oidc"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+)
+
+// OIDCStartHandler begins a social login. The client opens the returned URL
+// and, once the provider redirects back, posts the code and state to
+// OIDCCallbackHandler.
+func OIDCStartHandler(c *gin.Context) {
+	var req models.OIDCStartRequest
+	// The body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	startOIDC(c, req.DeviceName, "")
+}
+
+// OIDCLinkHandler begins linking another provider to the caller's account
+func OIDCLinkHandler(c *gin.Context) {
+	startOIDC(c, "", c.GetString("userId"))
+}
+
+func startOIDC(c *gin.Context, deviceName, linkUserID string) {
+	start, err := services.StartOIDC(c.Request.Context(), c.Param("provider"), deviceName, linkUserID)
+	if err == oidc.ErrUnknownProvider {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error starting OIDC login: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Login provider is unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, start)
+}
+
+// OIDCCallbackHandler finishes a social login or link started by OIDCStartHandler
+// or OIDCLinkHandler
+func OIDCCallbackHandler(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	result, err := services.FinishOIDC(c.Request.Context(), c.Param("provider"), req.Code, req.State)
+	switch {
+	case err == nil:
+	case err == oidc.ErrUnknownProvider:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	case err == services.ErrInvalidOIDCState:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login expired, please try again"})
+		return
+	case errors.Is(err, oidc.ErrExchangeFailed), errors.Is(err, oidc.ErrInvalidIDToken):
+		log.Printf("⚠️ OIDC login rejected: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was rejected by the provider"})
+		return
+	case err == services.ErrIdentityLinkedElsewhere:
+		c.JSON(http.StatusConflict, gin.H{"error": "That account is already linked to another BitDrop user"})
+		return
+	case err == services.ErrAccountExists:
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists. Log in and link it from your settings."})
+		return
+	case err == services.ErrEmailRequired:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The provider did not share an email address"})
+		return
+	case err == services.ErrEmailNotVerified:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verify your email address with the provider first"})
+		return
+	default:
+		log.Printf("❌ Error finishing OIDC login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if result.Linked {
+		c.JSON(http.StatusOK, gin.H{"message": "Account linked"})
+		return
+	}
+
+	user, err := services.GetUserByID(c.Request.Context(), result.UserID)
+	if err != nil {
+		log.Printf("❌ Error loading user after OIDC login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	completeLogin(c, user, result.DeviceName)
+}
+
+// ListIdentitiesHandler returns the login methods linked to the caller's account
+func ListIdentitiesHandler(c *gin.Context) {
+	identities, hasPassword, err := services.ListIdentities(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		log.Printf("❌ Error listing identities: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch identities"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": identities, "has_password": hasPassword})
+}
+
+// UnlinkIdentityHandler removes a linked provider from the caller's account
+func UnlinkIdentityHandler(c *gin.Context) {
+	identityID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		return
+	}
+
+	err = services.UnlinkIdentity(c.Request.Context(), c.GetString("userId"), identityID)
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked"})
+	case services.ErrIdentityNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+	case services.ErrLastLoginMethod:
+		c.JSON(http.StatusConflict, gin.H{"error": "Set a password or link another provider before removing this one"})
+	default:
+		log.Printf("❌ Error unlinking identity: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink identity"})
+	}
+}
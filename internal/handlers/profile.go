@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/media"
 	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/services"
 )
 
 func GetProfile(c *gin.Context) {
@@ -22,25 +26,7 @@ func GetProfile(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-
-	err := db.DB.QueryRow(context.Background(), `
-		SELECT id, email, username, avatar_url, bio, tier, boosts_left, is_admin, created_at, last_active
-		FROM users
-		WHERE id = $1
-	`, userId).Scan(
-		&user.ID,
-		&user.Email,
-		&user.Username,
-		&user.AvatarURL,
-		&user.Bio,
-		&user.Tier,
-		&user.BoostsLeft,
-		&user.IsAdmin,
-		&user.CreatedAt,
-		&user.LastActive,
-	)
-
+	user, err := services.GetUserByID(context.Background(), userId)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -50,3 +36,131 @@ func GetProfile(c *gin.Context) {
 		"user": user,
 	})
 }
+
+// CompleteOnboardingHandler lets an auto-provisioned user replace their
+// generated username with one they chose
+func CompleteOnboardingHandler(c *gin.Context) {
+	var req models.OnboardingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, err := services.CompleteOnboarding(c.Request.Context(), c.GetString("userId"), req.Username)
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, gin.H{"user": user})
+	case services.ErrInvalidUsername:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case services.ErrUsernameTaken:
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already taken"})
+	case services.ErrOnboardingComplete:
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already chosen; change it from your profile instead"})
+	default:
+		log.Printf("❌ Error completing onboarding: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update username"})
+	}
+}
+
+// UpdateProfileHandler changes the caller's display name, bio or username
+func UpdateProfileHandler(c *gin.Context) {
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, err := services.UpdateProfile(c.Request.Context(), c.GetString("userId"), req)
+	var cooldown *services.UsernameCooldownError
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"user": user})
+	case err == services.ErrInvalidUsername || err == services.ErrProfileFieldTooLong:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err == services.ErrUsernameTaken:
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already taken"})
+	case errors.As(err, &cooldown):
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":                 "You changed your username recently, please try again later",
+			"username_change_after": cooldown.Until,
+		})
+	default:
+		log.Printf("❌ Error updating profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+	}
+}
+
+// GetUsernameHistoryHandler lists the caller's previous usernames
+func GetUsernameHistoryHandler(c *gin.Context) {
+	history, err := services.UsernameHistory(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		log.Printf("❌ Error fetching username history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch username history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+// Largest avatar upload accepted, before resizing
+const maxAvatarSize = 10 << 20
+
+// UploadAvatarHandler replaces the caller's avatar with the image in the
+// "avatar" form field
+func UploadAvatarHandler(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarSize+1<<20)
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar images are limited to 10 MB"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar image is required"})
+		return
+	}
+	if file.Size > maxAvatarSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar images are limited to 10 MB"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read avatar"})
+		return
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read avatar"})
+		return
+	}
+
+	userID := c.GetString("userId")
+	urls, err := services.UploadAvatar(c.Request.Context(), userID, data)
+	if errors.Is(err, media.ErrUnsupportedImage) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Avatars must be JPEG, PNG or GIF images at least 64×64 pixels"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error uploading avatar: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload avatar"})
+		return
+	}
+
+	user, err := services.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user, "avatar_urls": urls})
+}
+
+// DeleteAvatarHandler removes the caller's avatar
+func DeleteAvatarHandler(c *gin.Context) {
+	if err := services.RemoveAvatar(c.Request.Context(), c.GetString("userId")); err != nil {
+		log.Printf("❌ Error removing avatar: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove avatar"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
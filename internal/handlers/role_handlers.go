@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/rbac"
+)
+
+// ListUserRolesHandler returns a user's role assignments
+func ListUserRolesHandler(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	assignments, err := rbac.ListAssignments(c.Request.Context(), userID.String())
+	if err != nil {
+		log.Printf("❌ Error listing roles: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": assignments})
+}
+
+// AssignUserRoleHandler gives a user a role, optionally scoped to a group
+func AssignUserRoleHandler(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	var req models.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err = rbac.Assign(c.Request.Context(), userID.String(), rbac.Role(req.Role), req.GroupID)
+	if err == rbac.ErrUnknownRole {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+	if err == rbac.ErrUnknownUser {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error assigning role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+	log.Printf("🛡️ %s assigned role %s to %s", c.GetString("userId"), req.Role, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Role assigned"})
+}
+
+// RevokeUserRoleHandler removes a role from a user. Pass ?group_id= to remove a group-scoped role.
+func RevokeUserRoleHandler(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	var groupID *uuid.UUID
+	if g := c.Query("group_id"); g != "" {
+		id, err := uuid.Parse(g)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_id"})
+			return
+		}
+		groupID = &id
+	}
+
+	if err := rbac.Revoke(c.Request.Context(), userID.String(), rbac.Role(c.Param("role")), groupID); err != nil {
+		log.Printf("❌ Error revoking role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke role"})
+		return
+	}
+	log.Printf("🛡️ %s revoked role %s from %s", c.GetString("userId"), c.Param("role"), userID)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+)
+
+// ListSessionsHandler returns the caller's active sessions
+func ListSessionsHandler(c *gin.Context) {
+	userID := c.GetString("userId")
+	sessions, err := services.ListSessions(c.Request.Context(), userID, c.GetString("sessionId"))
+	if err != nil {
+		log.Printf("❌ Error listing sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSessionHandler logs one of the caller's sessions out
+func RevokeSessionHandler(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	err = services.RevokeSession(c.Request.Context(), c.GetString("userId"), sessionID)
+	if err == services.ErrSessionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error revoking session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessionsHandler logs out every session except the one making the request
+func RevokeOtherSessionsHandler(c *gin.Context) {
+	revoked, err := services.RevokeOtherSessions(c.Request.Context(), c.GetString("userId"), c.GetString("sessionId"))
+	if err != nil {
+		log.Printf("❌ Error revoking sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked", "revoked": revoked})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+)
+
+// GetTOTPStatusHandler reports whether the caller has 2FA enabled
+func GetTOTPStatusHandler(c *gin.Context) {
+	status, err := services.GetTOTPStatus(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		log.Printf("❌ Error fetching 2FA status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// EnrollTOTPHandler starts 2FA setup and returns the secret to add to an authenticator app
+func EnrollTOTPHandler(c *gin.Context) {
+	userID := c.GetString("userId")
+	user, err := services.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	enrollment, err := services.EnrollTOTP(c.Request.Context(), userID, user.Email)
+	if err == services.ErrTOTPAlreadyEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error enrolling 2FA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// EnableTOTPHandler confirms enrollment with a code and returns recovery codes
+func EnableTOTPHandler(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	codes, err := services.EnableTOTP(c.Request.Context(), c.GetString("userId"), req.Code)
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recovery_codes": codes})
+	case services.ErrTOTPNotEnrolled:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+	case services.ErrTOTPAlreadyEnabled:
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+	case services.ErrInvalidTOTPCode:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+	default:
+		log.Printf("❌ Error enabling 2FA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+	}
+}
+
+// DisableTOTPHandler turns 2FA off given a current TOTP or recovery code
+func DisableTOTPHandler(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := services.DisableTOTP(c.Request.Context(), c.GetString("userId"), req.Code)
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+	case services.ErrTOTPNotEnrolled:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+	case services.ErrInvalidTOTPCode:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+	default:
+		log.Printf("❌ Error disabling 2FA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+	}
+}
+
+// RegenerateRecoveryCodesHandler replaces the caller's recovery codes
+func RegenerateRecoveryCodesHandler(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	codes, err := services.RegenerateRecoveryCodes(c.Request.Context(), c.GetString("userId"), req.Code)
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	case services.ErrTOTPNotEnrolled:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+	case services.ErrInvalidTOTPCode:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+	default:
+		log.Printf("❌ Error regenerating recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate recovery codes"})
+	}
+}
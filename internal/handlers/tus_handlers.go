@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+	"github.com/richiethie/BitDrop.Server/internal/uploads"
+)
+
+// Resumable drop uploads implementing the tus 1.0.0 protocol with the
+// creation, termination and expiration extensions. See https://tus.io/protocols/resumable-upload
+
+const tusVersion = "1.0.0"
+
+// setTusHeaders sets the headers every tus response carries, plus the
+// upload state when r is known
+func setTusHeaders(c *gin.Context, r *uploads.Resumable) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	if r != nil {
+		c.Header("Upload-Offset", strconv.FormatInt(r.Offset, 10))
+		c.Header("Upload-Length", strconv.FormatInt(r.Length, 10))
+		c.Header("Upload-Expires", r.ExpiresAt.UTC().Format(http.TimeFormat))
+		if r.DropID != nil {
+			c.Header("X-Drop-ID", r.DropID.String())
+		}
+	}
+}
+
+// checkTusVersion rejects requests for a protocol version we do not speak
+func checkTusVersion(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// parseTusMetadata decodes an Upload-Metadata header ("key base64value,...")
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if header == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, errors.New("malformed Upload-Metadata")
+		}
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, errors.New("malformed Upload-Metadata value for " + fields[0])
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+	return metadata, nil
+}
+
+// loadOwnedUpload fetches the upload named in the URL if it belongs to the caller
+func loadOwnedUpload(c *gin.Context) (*uploads.Resumable, bool) {
+	userIDVal, _ := c.Get("userId")
+	r, err := uploads.GetResumable(c.Request.Context(), c.Param("id"))
+	if err == uploads.ErrUploadNotFound || (err == nil && r.UserID != userIDVal) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Println("Failed to load upload:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	return r, true
+}
+
+// lockUpload takes r's row lock, responding 404 if the upload ended in the
+// meantime. Call the returned func to release it.
+func lockUpload(c *gin.Context, r *uploads.Resumable) (func() error, bool) {
+	unlock, err := r.Lock(c.Request.Context())
+	if err == uploads.ErrUploadNotFound {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Println("Failed to lock upload:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	return unlock, true
+}
+
+// TusOptionsHandler advertises the supported tus version and extensions
+func TusOptionsHandler(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", "creation,termination,expiration")
+	c.Header("Tus-Max-Size", strconv.Itoa(maxUploadSize))
+	c.Status(http.StatusNoContent)
+}
+
+// TusCreateHandler starts a resumable upload. Drop fields are passed in
+// Upload-Metadata as filename, filetype, caption, group_id and visibility.
+func TusCreateHandler(c *gin.Context) {
+	setTusHeaders(c, nil)
+	if !checkTusVersion(c) {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length is required"})
+		return
+	}
+	if length > maxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload exceeds the maximum size"})
+		return
+	}
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if metadata["visibility"], err = parseVisibility(metadata["visibility"]); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userIDVal, _ := c.Get("userId")
+	userIDStr, ok := userIDVal.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID in context"})
+		return
+	}
+
+	r, err := uploads.CreateResumable(c.Request.Context(), userIDStr, length, metadata)
+	if err != nil {
+		log.Println("Failed to create resumable upload:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	setTusHeaders(c, r)
+	c.Header("Location", strings.TrimRight(c.Request.URL.Path, "/")+"/"+r.ID.String())
+	c.Status(http.StatusCreated)
+}
+
+// TusHeadHandler reports how many bytes of an upload have been received
+func TusHeadHandler(c *gin.Context) {
+	setTusHeaders(c, nil)
+	if !checkTusVersion(c) {
+		return
+	}
+	r, ok := loadOwnedUpload(c)
+	if !ok {
+		return
+	}
+	setTusHeaders(c, r)
+	c.Status(http.StatusOK)
+}
+
+// TusPatchHandler appends a chunk to an upload. The chunk that completes the
+// upload also creates the drop, whose ID is returned in X-Drop-ID.
+func TusPatchHandler(c *gin.Context) {
+	setTusHeaders(c, nil)
+	if !checkTusVersion(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset is required"})
+		return
+	}
+
+	r, ok := loadOwnedUpload(c)
+	if !ok {
+		return
+	}
+
+	// The chunk is received before taking the lock, so a slow client doesn't
+	// hold the upload's row and a database connection for the whole transfer
+	var chunk *os.File
+	var received int64
+	var readErr error
+	if !r.Complete() {
+		if offset != r.Offset {
+			setTusHeaders(c, r)
+			c.AbortWithStatus(http.StatusConflict)
+			return
+		}
+		chunk, err = uploads.NewChunkFile()
+		if err != nil {
+			log.Println("Failed to create chunk file:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(chunk.Name())
+		defer chunk.Close()
+
+		// Whatever arrived is kept even if the connection drops mid-chunk,
+		// so the client can resume from there
+		received, readErr = io.Copy(chunk, io.LimitReader(c.Request.Body, r.Length-offset))
+		if _, err := chunk.Seek(0, io.SeekStart); err != nil {
+			log.Println("Failed to rewind chunk file:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		unlock, ok := lockUpload(c, r)
+		if !ok {
+			return
+		}
+		defer unlock()
+
+		// Another request may have completed the upload while this chunk arrived
+		if !r.Complete() {
+			err = r.Append(c.Request.Context(), offset, chunk, received)
+		}
+		if err == uploads.ErrOffsetMismatch {
+			setTusHeaders(c, r)
+			c.AbortWithStatus(http.StatusConflict)
+			return
+		}
+		if err == nil {
+			err = unlock()
+		}
+		if err != nil {
+			log.Println("Failed to write upload chunk:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		setTusHeaders(c, r)
+		if readErr != nil {
+			log.Println("Failed to read upload chunk:", readErr)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !r.Complete() {
+			c.Status(http.StatusNoContent)
+			return
+		}
+	}
+
+	// Every byte has arrived. The drop is created without holding the lock;
+	// if that failed before, this PATCH retries it.
+	setTusHeaders(c, r)
+	if r.DropID != nil {
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	}
+	if completeResumableUpload(c, r) {
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// TusDeleteHandler terminates an upload and discards its bytes
+func TusDeleteHandler(c *gin.Context) {
+	setTusHeaders(c, nil)
+	if !checkTusVersion(c) {
+		return
+	}
+	r, ok := loadOwnedUpload(c)
+	if !ok {
+		return
+	}
+	if err := r.Terminate(c.Request.Context()); err != nil {
+		log.Println("Failed to terminate upload:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// completeResumableUpload creates the drop for a fully received upload,
+// writing an error response and returning false if that fails. Uploads
+// rejected by inspection are terminated since retrying cannot succeed.
+func completeResumableUpload(c *gin.Context, r *uploads.Resumable) bool {
+	err := finishResumableUpload(c.Request.Context(), r)
+	if err == nil {
+		setTusHeaders(c, r)
+		return true
+	}
+	if err == uploads.ErrUploadClaimed {
+		// A concurrent request created the drop
+		c.AbortWithStatus(http.StatusConflict)
+		return false
+	}
+
+	var invalid errInvalidVideo
+	if errors.As(err, &invalid) {
+		if err := r.Terminate(c.Request.Context()); err != nil {
+			log.Println("Failed to terminate rejected upload:", err)
+		}
+		respondInspectError(c, err)
+		return false
+	}
+	log.Println("Failed to create drop from upload:", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create drop"})
+	return false
+}
+
+// finishResumableUpload stores the assembled file and creates its drop
+func finishResumableUpload(ctx context.Context, r *uploads.Resumable) error {
+	userID, err := uuid.Parse(r.UserID)
+	if err != nil {
+		return err
+	}
+	var groupID *uuid.UUID
+	if gid, err := uuid.Parse(r.Metadata["group_id"]); err == nil {
+		groupID = &gid
+	}
+
+	videoPath, err := r.Assemble(ctx)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(videoPath)
+
+	meta, err := inspectVideo(ctx, userID, videoPath)
+	if err != nil {
+		return err
+	}
+
+	// Validated when the upload was created
+	visibility, err := parseVisibility(r.Metadata["visibility"])
+	if err != nil {
+		return err
+	}
+	private := visibility != models.DropVisibilityPublic
+	videoKey, err := storeVideoFile(ctx, videoPath, meta, private)
+	if err != nil {
+		return err
+	}
+
+	// Marking the upload complete with the insert means a request that fails
+	// here can be retried, and concurrent ones create a single drop
+	dropID := uuid.New()
+	claim := func(tx pgx.Tx) error { return r.Claim(ctx, tx, dropID) }
+	if _, err := createDrop(ctx, dropID, userID, groupID, r.Metadata["caption"], visibility, videoKey, private, meta, claim); err != nil {
+		_ = storage.For(private).Delete(context.Background(), videoKey)
+		return err
+	}
+	r.Finish(ctx, dropID)
+	return nil
+}
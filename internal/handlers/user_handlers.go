@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+)
+
+// Page size for a user's drop list
+const (
+	defaultDropPageSize = 30
+	maxDropPageSize     = 100
+)
+
+// lookupUserID finds an active account by its current username
+func lookupUserID(c *gin.Context, username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	var id string
+	err := db.DB.QueryRow(c.Request.Context(), `
+		SELECT id FROM users WHERE LOWER(username) = $1 AND deletion_scheduled_at IS NULL
+	`, username).Scan(&id)
+	return id, err
+}
+
+// GetPublicProfileHandler returns another user's public profile
+func GetPublicProfileHandler(c *gin.Context) {
+	userID, err := lookupUserID(c, c.Param("username"))
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error looking up user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+
+	visible, visibleArgs, err := visibleDropsCondition(c, "d", 2)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+
+	var p models.PublicProfile
+	err = db.DB.QueryRow(c.Request.Context(), `
+		SELECT u.id, u.username, u.display_name, u.avatar_url, u.bio, u.tier, u.created_at,
+		       COUNT(d.id), COALESCE(SUM(d.votes), 0)
+		FROM users u
+		LEFT JOIN drops d ON d.user_id = u.id AND `+visible+`
+		WHERE u.id = $1
+		GROUP BY u.id
+	`, append([]any{userID}, visibleArgs...)...).Scan(
+		&p.ID, &p.Username, &p.DisplayName, &p.AvatarURL, &p.Bio, &p.Tier, &p.CreatedAt,
+		&p.DropCount, &p.TotalVotes,
+	)
+	if err != nil {
+		log.Printf("❌ Error fetching profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+	if p.Tier != "" && p.Tier != "free" {
+		p.Badge = p.Tier
+	}
+	c.JSON(http.StatusOK, gin.H{"user": p})
+}
+
+// GetPublicUserDropsHandler lists a user's drops that the caller may see,
+// newest first. Pass the created_at of the last drop as ?before= for the
+// next page.
+func GetPublicUserDropsHandler(c *gin.Context) {
+	userID, err := lookupUserID(c, c.Param("username"))
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error looking up user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drops"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > maxDropPageSize {
+		limit = defaultDropPageSize
+	}
+	before := time.Now().Add(time.Hour)
+	if v := c.Query("before"); v != "" {
+		if before, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+
+	visible, visibleArgs, err := visibleDropsCondition(c, "d", 4)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	rows, err := db.DB.Query(c.Request.Context(), `
+		SELECT `+selectDropColumns("d")+`
+		FROM drops d
+		WHERE d.user_id = $1 AND d.created_at < $2 AND `+visible+`
+		ORDER BY d.created_at DESC
+		LIMIT $3
+	`, append([]any{userID, before, limit}, visibleArgs...)...)
+	if err != nil {
+		log.Printf("❌ Error fetching drops: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drops"})
+		return
+	}
+	defer rows.Close()
+
+	drops := []models.Drop{}
+	for rows.Next() {
+		var d models.Drop
+		if err := scanDrop(rows, &d); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan drop: " + err.Error()})
+			return
+		}
+		drops = append(drops, d)
+	}
+	if !signDrops(c, dropPointers(drops)...) {
+		return
+	}
+	c.JSON(http.StatusOK, drops)
+}
@@ -0,0 +1,272 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+// Job statuses stored in the jobs table
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+const (
+	defaultMaxAttempts = 5
+	baseBackoff        = 10 * time.Second
+	maxBackoff         = time.Hour
+	pollInterval       = time.Second
+
+	// Workers bump locked_at every heartbeatInterval while a job runs. A
+	// running job without a heartbeat for staleAfter is assumed to belong to
+	// a crashed worker and is picked up again.
+	heartbeatInterval = time.Minute
+	staleAfter        = 5 * time.Minute
+)
+
+// Job is a claimed unit of work
+type Job struct {
+	ID          int64
+	Kind        string
+	Payload     json.RawMessage
+	Attempts    int
+	MaxAttempts int
+}
+
+// Handler processes jobs of one kind. OnFailure, if set, is called once the
+// job has exhausted its attempts.
+type Handler struct {
+	Run       func(ctx context.Context, job *Job) error
+	OnFailure func(ctx context.Context, job *Job, err error)
+}
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[string]Handler{}
+)
+
+// Register installs the handler for kind
+func Register(kind string, h Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[kind] = h
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job fails immediately instead of being retried
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Enqueue adds a job of kind with a JSON-encoded payload. Pass a transaction
+// as e to enqueue atomically with the rows the job refers to.
+func Enqueue(ctx context.Context, e db.Execer, kind string, payload any) error {
+	return EnqueueAt(ctx, e, kind, payload, time.Now())
+}
+
+// EnqueueAt is Enqueue for a job that shouldn't run before runAt
+func EnqueueAt(ctx context.Context, e db.Execer, kind string, payload any, runAt time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode job payload: %w", err)
+	}
+	_, err = e.Exec(ctx, `
+		INSERT INTO jobs (kind, payload, status, attempts, max_attempts, run_at, created_at, updated_at)
+		VALUES ($1, $2, 'pending', 0, $3, $4, NOW(), NOW())
+	`, kind, string(data), defaultMaxAttempts, runAt)
+	return err
+}
+
+// claim locks the next runnable job and marks it running. It returns nil
+// when there is nothing to do.
+func claim(ctx context.Context) (*Job, error) {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var job Job
+	var payload string
+	err = tx.QueryRow(ctx, `
+		SELECT id, kind, payload, attempts, max_attempts
+		FROM jobs
+		WHERE (status = 'pending' AND run_at <= NOW())
+		   OR (status = 'running' AND locked_at < $1)
+		ORDER BY run_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, time.Now().Add(-staleAfter)).Scan(&job.ID, &job.Kind, &payload, &job.Attempts, &job.MaxAttempts)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	job.Payload = json.RawMessage(payload)
+	job.Attempts++
+
+	_, err = tx.Exec(ctx, `
+		UPDATE jobs SET status = 'running', attempts = $2, locked_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, job.ID, job.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	return &job, tx.Commit(ctx)
+}
+
+// backoff returns the delay before retrying after the given attempt
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << (attempt - 1)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	// Up to 20% jitter so failed jobs do not retry in lockstep
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+// process runs one claimed job and records the outcome
+func process(ctx context.Context, job *Job) {
+	handlersMu.RLock()
+	h, ok := handlers[job.Kind]
+	handlersMu.RUnlock()
+
+	var err error
+	if !ok {
+		err = Permanent(fmt.Errorf("no handler registered for job kind %q", job.Kind))
+	} else {
+		runCtx, cancel := context.WithCancel(ctx)
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			heartbeat(runCtx, job, cancel)
+		}()
+		err = runSafely(runCtx, h, job)
+		cancel()
+		<-stopped
+	}
+
+	// The updates below match on attempts so a worker that lost the job to
+	// another one doesn't overwrite its outcome
+	if err == nil {
+		_, err = db.DB.Exec(ctx, `UPDATE jobs SET status = 'done', last_error = NULL, updated_at = NOW() WHERE id = $1 AND attempts = $2`, job.ID, job.Attempts)
+		if err != nil {
+			log.Printf("Job %d: failed to mark done: %v", job.ID, err)
+		}
+		return
+	}
+
+	var permanent permanentError
+	if job.Attempts < job.MaxAttempts && !errors.As(err, &permanent) {
+		delay := backoff(job.Attempts)
+		log.Printf("Job %d (%s) attempt %d failed, retrying in %s: %v", job.ID, job.Kind, job.Attempts, delay, err)
+		_, dbErr := db.DB.Exec(ctx, `
+			UPDATE jobs SET status = 'pending', run_at = $2, last_error = $3, updated_at = NOW() WHERE id = $1 AND attempts = $4
+		`, job.ID, time.Now().Add(delay), err.Error(), job.Attempts)
+		if dbErr != nil {
+			log.Printf("Job %d: failed to reschedule: %v", job.ID, dbErr)
+		}
+		return
+	}
+
+	log.Printf("Job %d (%s) failed permanently after %d attempts: %v", job.ID, job.Kind, job.Attempts, err)
+	_, dbErr := db.DB.Exec(ctx, `
+		UPDATE jobs SET status = 'failed', last_error = $2, updated_at = NOW() WHERE id = $1 AND attempts = $3
+	`, job.ID, err.Error(), job.Attempts)
+	if dbErr != nil {
+		log.Printf("Job %d: failed to mark failed: %v", job.ID, dbErr)
+	}
+	if ok && h.OnFailure != nil {
+		h.OnFailure(ctx, job, err)
+	}
+}
+
+// heartbeat keeps job's claim fresh until ctx is done. If another worker has
+// taken the job over meanwhile, it calls lost to stop the handler.
+func heartbeat(ctx context.Context, job *Job, lost func()) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tag, err := db.DB.Exec(ctx, `
+				UPDATE jobs SET locked_at = NOW() WHERE id = $1 AND status = 'running' AND attempts = $2
+			`, job.ID, job.Attempts)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Job %d: heartbeat failed: %v", job.ID, err)
+				}
+				continue
+			}
+			if tag.RowsAffected() == 0 {
+				log.Printf("Job %d (%s) was taken over by another worker, stopping", job.ID, job.Kind)
+				lost()
+				return
+			}
+		}
+	}
+}
+
+// runSafely turns a handler panic into an error so one bad job cannot kill a worker
+func runSafely(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h.Run(ctx, job)
+}
+
+// Run starts concurrency workers and blocks until ctx is cancelled and
+// every in-flight job has finished
+func Run(ctx context.Context, concurrency int) {
+	hostname, _ := os.Hostname()
+	log.Printf("Starting %d job workers on %s", concurrency, hostname)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for {
+				if ctx.Err() != nil {
+					return
+				}
+				job, err := claim(ctx)
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Worker %d: failed to claim job: %v", worker, err)
+				}
+				if job == nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(pollInterval):
+					}
+					continue
+				}
+				// Let the current job finish even if shutdown was requested
+				process(context.WithoutCancel(ctx), job)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ConsoleMailer logs messages instead of sending them. With Redact set, link
+// tokens are masked so the logs don't hold working reset or verification links.
+type ConsoleMailer struct {
+	Redact bool
+}
+
+// linkToken matches the token query parameter of links in emails
+var linkToken = regexp.MustCompile(`([?&]token=)[^&\s]+`)
+
+func (m ConsoleMailer) Send(ctx context.Context, msg Message) error {
+	body := msg.Body
+	if m.Redact {
+		body = redactTokens(body)
+	}
+	log.Printf("✉️ To: %s\nSubject: %s\n\n%s", msg.To, msg.Subject, body)
+	return nil
+}
+
+// redactTokens masks the token of every link in s
+func redactTokens(s string) string {
+	return linkToken.ReplaceAllString(s, "${1}[redacted]")
+}
+
+// FileMailer writes each message to Dir as an .eml file, for local development
+// and tests
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewString())
+	return os.WriteFile(filepath.Join(m.Dir, name), formatMessage(m.From, msg), 0o644)
+}
@@ -0,0 +1,23 @@
+package mailer
+
+import "testing"
+
+func TestRedactTokens(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"reset link", "Open https://bitdrop.app/reset?token=abc123 now", "Open https://bitdrop.app/reset?token=[redacted] now"},
+		{"token after other params", "https://x/verify?a=1&token=abc&b=2", "https://x/verify?a=1&token=[redacted]&b=2"},
+		{"escaped token", "https://x/reset?token=a%2Bb%3D\n", "https://x/reset?token=[redacted]\n"},
+		{"two links", "?token=one and ?token=two", "?token=[redacted] and ?token=[redacted]"},
+		{"no link", "Your account will be deleted.", "Your account will be deleted."},
+		{"other params kept", "https://x/?code=1&state=2", "https://x/?code=1&state=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactTokens(tt.in); got != tt.want {
+				t.Errorf("redactTokens(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
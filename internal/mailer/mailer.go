@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Default is the mailer selected by Init
+var Default Mailer = ConsoleMailer{Redact: true}
+
+// Init picks the mailer from MAILER: "console", "file" or "smtp". Without
+// MAILER, mail is only logged, with link tokens redacted; set MAILER=console
+// in development to log usable links.
+func Init() error {
+	backend := os.Getenv("MAILER")
+	if backend == "" {
+		log.Println("⚠️ MAILER not set, logging email with link tokens redacted")
+		Default = ConsoleMailer{Redact: true}
+		return nil
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "BitDrop <no-reply@bitdrop.app>"
+	}
+
+	switch backend {
+	case "console":
+		Default = ConsoleMailer{}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./data/mail"
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create mail directory: %w", err)
+		}
+		Default = FileMailer{Dir: dir, From: from}
+	case "smtp":
+		port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if port == 0 {
+			port = 587
+		}
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return fmt.Errorf("SMTP_HOST is required for the smtp mailer")
+		}
+		Default = &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	default:
+		return fmt.Errorf("unknown MAILER %q", backend)
+	}
+
+	fmt.Printf("✉️ Using %s mailer\n", backend)
+	return nil
+}
+
+// Send delivers msg with the default mailer
+func Send(ctx context.Context, msg Message) error {
+	return Default.Send(ctx, msg)
+}
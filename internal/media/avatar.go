@@ -0,0 +1,202 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the GIF decoder for avatar uploads
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder for avatar uploads
+	"io"
+)
+
+// Avatar limits. Uploads are re-encoded, so only the pixels survive; EXIF and
+// any other metadata are dropped.
+const (
+	AvatarMinSide   = 64
+	AvatarMaxPixels = 4096 * 4096
+	avatarQuality   = 85
+)
+
+// ErrUnsupportedImage is returned for uploads that aren't a JPEG, PNG or GIF
+// of a usable size
+var ErrUnsupportedImage = errors.New("unsupported image")
+
+// DecodeAvatar validates and decodes an uploaded image into an upright square
+// of at most size×size. The full image is only walked once, here; every
+// stored size is then made from the small square.
+func DecodeAvatar(data []byte, size int) (*image.RGBA, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if cfg.Width < AvatarMinSide || cfg.Height < AvatarMinSide {
+		return nil, fmt.Errorf("%w: images must be at least %dx%d", ErrUnsupportedImage, AvatarMinSide, AvatarMinSide)
+	}
+	// Checked before decoding so a tiny file can't claim a huge canvas
+	if cfg.Width*cfg.Height > AvatarMaxPixels {
+		return nil, fmt.Errorf("%w: image is too large", ErrUnsupportedImage)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	// The centre crop covers the same area however the image is turned, so
+	// the orientation is applied to the small square
+	square := SquareAvatar(img, min(size, cfg.Width, cfg.Height))
+	if format == "jpeg" {
+		return orient(square, jpegOrientation(data)), nil
+	}
+	return square, nil
+}
+
+// SquareAvatar centre-crops img to a square and scales it to size×size
+func SquareAvatar(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(b.Min).Add(image.Pt((b.Dx()-side)/2, (b.Dy()-side)/2))
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0 := crop.Min.Y + y*side/size
+		y1 := max(crop.Min.Y+(y+1)*side/size, y0+1)
+		for x := 0; x < size; x++ {
+			x0 := crop.Min.X + x*side/size
+			x1 := max(crop.Min.X+(x+1)*side/size, x0+1)
+
+			// Box filter: average every source pixel under the destination pixel
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+// EncodeAvatar writes img as a JPEG without metadata. Transparent areas
+// become white rather than black.
+func EncodeAvatar(w io.Writer, img *image.RGBA) error {
+	for i := 0; i < len(img.Pix); i += 4 {
+		if a := img.Pix[i+3]; a != 0xff {
+			// Pixels are premultiplied, so compositing over white only adds
+			bg := 0xff - a
+			img.Pix[i+0] += bg
+			img.Pix[i+1] += bg
+			img.Pix[i+2] += bg
+			img.Pix[i+3] = 0xff
+		}
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: avatarQuality})
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 when it
+// has none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xda || length < 2 || i+2+length > len(data) {
+			// Start of scan: the metadata segments are behind us
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the Orientation tag from IFD0 of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		p := ifd + 2 + e*12
+		if p+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[p:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[p+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient transforms img so that an image with the given EXIF orientation is
+// displayed upright
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		// 5-8 swap the axes
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y):][:4])
+		}
+	}
+	return dst
+}
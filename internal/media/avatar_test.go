@@ -0,0 +1,252 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// tiffWithOrientation builds a TIFF structure whose IFD0 holds only the
+// Orientation tag
+func tiffWithOrientation(order binary.AppendByteOrder, orientation uint16) []byte {
+	b := []byte("II\x2a\x00")
+	if order == binary.BigEndian {
+		b = []byte("MM\x00\x2a")
+	}
+	b = order.AppendUint32(b, 8)
+	b = order.AppendUint16(b, 1)      // one entry
+	b = order.AppendUint16(b, 0x0112) // Orientation
+	b = order.AppendUint16(b, 3)      // SHORT
+	b = order.AppendUint32(b, 1)
+	b = order.AppendUint16(b, orientation)
+	b = append(b, 0, 0)
+	return order.AppendUint32(b, 0) // no next IFD
+}
+
+// jpegSegment encodes a JPEG marker segment
+func jpegSegment(marker byte, payload []byte) []byte {
+	b := []byte{0xff, marker}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(payload)+2))
+	return append(b, payload...)
+}
+
+func exifSegment(tiff []byte) []byte {
+	return jpegSegment(0xe1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	soi := []byte{0xff, 0xd8}
+	jfif := jpegSegment(0xe0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))
+	sos := jpegSegment(0xda, []byte{0x01, 0x01, 0x00, 0x00, 0x3f, 0x00})
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no EXIF", join(soi, jfif, sos), 1},
+		{"little-endian EXIF", join(soi, exifSegment(tiffWithOrientation(binary.LittleEndian, 6))), 6},
+		{"big-endian EXIF after JFIF", join(soi, jfif, exifSegment(tiffWithOrientation(binary.BigEndian, 3))), 3},
+		{"EXIF after the image data is ignored", join(soi, sos, exifSegment(tiffWithOrientation(binary.LittleEndian, 8))), 1},
+		{"APP1 that isn't EXIF", join(soi, jpegSegment(0xe1, []byte("http://ns.adobe.com/xap/1.0/\x00")), sos), 1},
+		{"segment longer than the file", join(soi, []byte{0xff, 0xe1, 0xff, 0xff, 'E', 'x'}), 1},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	valid := tiffWithOrientation(binary.LittleEndian, 5)
+	badOffset := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint32(badOffset[4:], 1000)
+
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"little-endian", valid, 5},
+		{"big-endian", tiffWithOrientation(binary.BigEndian, 7), 7},
+		{"out of range", tiffWithOrientation(binary.LittleEndian, 9), 1},
+		{"zero", tiffWithOrientation(binary.BigEndian, 0), 1},
+		{"unknown byte order", append([]byte("XX"), valid[2:]...), 1},
+		{"IFD past the end", badOffset, 1},
+		{"truncated entry", valid[:14], 1},
+		{"too short", valid[:6], 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exifOrientation(tt.tiff); got != tt.want {
+				t.Errorf("exifOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3×2 image where only the top-left and top-right pixels are marked
+	topLeft := color.RGBA{255, 0, 0, 255}
+	topRight := color.RGBA{0, 0, 255, 255}
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.SetRGBA(0, 0, topLeft)
+	src.SetRGBA(2, 0, topRight)
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		topLeft       image.Point
+		topRight      image.Point
+	}{
+		{1, 3, 2, image.Pt(0, 0), image.Pt(2, 0)},
+		{2, 3, 2, image.Pt(2, 0), image.Pt(0, 0)},
+		{3, 3, 2, image.Pt(2, 1), image.Pt(0, 1)},
+		{4, 3, 2, image.Pt(0, 1), image.Pt(2, 1)},
+		{5, 2, 3, image.Pt(0, 0), image.Pt(0, 2)},
+		{6, 2, 3, image.Pt(1, 0), image.Pt(1, 2)},
+		{7, 2, 3, image.Pt(1, 2), image.Pt(1, 0)},
+		{8, 2, 3, image.Pt(0, 2), image.Pt(0, 0)},
+		{9, 3, 2, image.Pt(0, 0), image.Pt(2, 0)},
+	}
+	for _, tt := range tests {
+		got := orient(src, tt.orientation)
+		if b := got.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.width, tt.height)
+			continue
+		}
+		if c := got.RGBAAt(tt.topLeft.X, tt.topLeft.Y); c != topLeft {
+			t.Errorf("orientation %d: top-left pixel not at %v", tt.orientation, tt.topLeft)
+		}
+		if c := got.RGBAAt(tt.topRight.X, tt.topRight.Y); c != topRight {
+			t.Errorf("orientation %d: top-right pixel not at %v", tt.orientation, tt.topRight)
+		}
+	}
+}
+
+// stripes returns a w×h image split into equal vertical stripes of cols
+func stripes(w, h int, cols ...color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, cols[x*len(cols)/w])
+		}
+	}
+	return img
+}
+
+var (
+	red   = color.RGBA{255, 0, 0, 255}
+	green = color.RGBA{0, 255, 0, 255}
+	blue  = color.RGBA{0, 0, 255, 255}
+	black = color.RGBA{0, 0, 0, 255}
+	white = color.RGBA{255, 255, 255, 255}
+)
+
+func TestSquareAvatar(t *testing.T) {
+	checker := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	checker.SetRGBA(0, 0, black)
+	checker.SetRGBA(1, 0, white)
+	checker.SetRGBA(0, 1, white)
+	checker.SetRGBA(1, 1, black)
+
+	tests := []struct {
+		name string
+		img  image.Image
+		size int
+		want color.RGBA // every output pixel
+	}{
+		{"landscape keeps the centre", stripes(300, 100, red, green, blue), 64, green},
+		{"portrait keeps the centre", rotate90(stripes(300, 100, red, green, blue)), 50, green},
+		{"box filter averages", checker, 1, color.RGBA{127, 127, 127, 255}},
+		{"small images are scaled up", stripes(2, 2, blue), 16, blue},
+		{"offset bounds", stripes(300, 100, red, green, blue).SubImage(image.Rect(50, 0, 250, 100)), 10, green},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SquareAvatar(tt.img, tt.size)
+			if b := got.Bounds(); b.Dx() != tt.size || b.Dy() != tt.size {
+				t.Fatalf("size %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.size, tt.size)
+			}
+			for y := 0; y < tt.size; y++ {
+				for x := 0; x < tt.size; x++ {
+					if c := got.RGBAAt(x, y); c != tt.want {
+						t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, c, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// rotate90 turns img a quarter clockwise
+func rotate90(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dst.SetRGBA(b.Dy()-1-y, x, img.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
+
+func TestDecodeAvatar(t *testing.T) {
+	encodePNG := func(img image.Image) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	// A JPEG stored sideways: red on the left, blue on the right, to be
+	// rotated clockwise for display so red ends up on top
+	var sideways bytes.Buffer
+	if err := jpeg.Encode(&sideways, stripes(128, 64, red, red, blue, blue), &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	data := sideways.Bytes()
+	data = append(append(append([]byte(nil), data[:2]...), exifSegment(tiffWithOrientation(binary.BigEndian, 6))...), data[2:]...)
+
+	img, err := DecodeAvatar(data, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 32 {
+		t.Fatalf("size %dx%d, want 32x32", b.Dx(), b.Dy())
+	}
+	if top, bottom := img.RGBAAt(16, 2), img.RGBAAt(16, 29); top.R < 200 || top.B > 60 || bottom.B < 200 || bottom.R > 60 {
+		t.Errorf("top = %v, bottom = %v, want red over blue", top, bottom)
+	}
+
+	// Images smaller than the requested size keep their own size
+	if img, err := DecodeAvatar(encodePNG(stripes(80, 100, green)), 512); err != nil || img.Bounds().Dx() != 80 {
+		t.Errorf("small image: %v, %v", img.Bounds(), err)
+	}
+
+	// Only the header is read for oversized images, so this stays cheap
+	huge := encodePNG(stripes(1, 1, green))
+	binary.BigEndian.PutUint32(huge[16:], 5000) // IHDR width
+	binary.BigEndian.PutUint32(huge[20:], 5000) // IHDR height
+	for name, data := range map[string][]byte{
+		"too large":  huge,
+		"too small":  encodePNG(stripes(32, 32, green)),
+		"not images": []byte("hello"),
+	} {
+		if _, err := DecodeAvatar(data, 512); !errors.Is(err, ErrUnsupportedImage) {
+			t.Errorf("%s: err = %v, want ErrUnsupportedImage", name, err)
+		}
+	}
+}
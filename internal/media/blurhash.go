@@ -0,0 +1,191 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strings"
+)
+
+// BlurHash and dominant-colour placeholders let clients paint a thumbnail's
+// shape and colour before the image itself loads. See https://blurha.sh
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Placeholder images are computed from a downsampled copy of this size
+const placeholderSampleSize = 32
+
+func encode83(value, length int) string {
+	var b strings.Builder
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		b.WriteByte(base83Chars[digit])
+	}
+	return b.String()
+}
+
+func sRGBToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// sample downsamples img to at most size×size pixels by box averaging,
+// returning sRGB values in [0,1]
+func sample(img image.Image, size int) ([][][3]float64, int, int) {
+	b := img.Bounds()
+	w, h := size, size
+	if b.Dx() > b.Dy() {
+		h = max(1, size*b.Dy()/b.Dx())
+	} else {
+		w = max(1, size*b.Dx()/b.Dy())
+	}
+
+	pixels := make([][][3]float64, h)
+	for y := 0; y < h; y++ {
+		pixels[y] = make([][3]float64, w)
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			var sum [3]float64
+			n := 0
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					r, g, bl, _ := img.At(sx, sy).RGBA()
+					sum[0] += float64(r) / 65535
+					sum[1] += float64(g) / 65535
+					sum[2] += float64(bl) / 65535
+					n++
+				}
+			}
+			pixels[y][x] = [3]float64{sum[0] / float64(n), sum[1] / float64(n), sum[2] / float64(n)}
+		}
+	}
+	return pixels, w, h
+}
+
+// BlurHash encodes img with xComponents×yComponents DCT components (1-9 each)
+func BlurHash(img image.Image, xComponents, yComponents int) string {
+	pixels, w, h := sample(img, placeholderSampleSize)
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(h))
+					for c := 0; c < 3; c++ {
+						f[c] += basis * sRGBToLinear(pixels[y][x][c])
+					}
+				}
+			}
+			scale := normalisation / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	dc, ac := factors[0], factors[1:]
+
+	var hash strings.Builder
+	hash.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maximumValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+	return hash.String()
+}
+
+// DominantColor returns the most common colour in img as "#rrggbb".
+// Colours are bucketed at 4 bits per channel and the winning bucket averaged.
+func DominantColor(img image.Image) string {
+	pixels, _, _ := sample(img, placeholderSampleSize*2)
+
+	type bucket struct {
+		count int
+		sum   [3]float64
+	}
+	buckets := map[int]*bucket{}
+	var best *bucket
+	for _, row := range pixels {
+		for _, p := range row {
+			k := int(p[0]*15+0.5)<<8 | int(p[1]*15+0.5)<<4 | int(p[2]*15+0.5)
+			b, ok := buckets[k]
+			if !ok {
+				b = &bucket{}
+				buckets[k] = b
+			}
+			b.count++
+			for c := 0; c < 3; c++ {
+				b.sum[c] += p[c]
+			}
+			if best == nil || b.count > best.count {
+				best = b
+			}
+		}
+	}
+	if best == nil {
+		return "#000000"
+	}
+	n := float64(best.count)
+	return fmt.Sprintf("#%02x%02x%02x",
+		int(best.sum[0]/n*255+0.5), int(best.sum[1]/n*255+0.5), int(best.sum[2]/n*255+0.5))
+}
+
+// Placeholder returns the BlurHash and dominant colour for the image at path
+func Placeholder(path string) (string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	// More components along the longer side
+	xComponents, yComponents := 4, 3
+	if img.Bounds().Dy() > img.Bounds().Dx() {
+		xComponents, yComponents = 3, 4
+	}
+	return BlurHash(img, xComponents, yComponents), DominantColor(img), nil
+}
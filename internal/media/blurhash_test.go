@@ -0,0 +1,106 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testImage builds a 32×32 image, the placeholder sample size, so BlurHash
+// sees exactly these pixels
+func testImage(pixel func(x, y int) color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, placeholderSampleSize, placeholderSampleSize))
+	for y := 0; y < placeholderSampleSize; y++ {
+		for x := 0; x < placeholderSampleSize; x++ {
+			img.SetRGBA(x, y, pixel(x, y))
+		}
+	}
+	return img
+}
+
+func TestBlurHash(t *testing.T) {
+	solid := testImage(func(x, y int) color.RGBA { return color.RGBA{255, 0, 0, 255} })
+	gradient := testImage(func(x, y int) color.RGBA { return color.RGBA{uint8(x * 8), 128, uint8(255 - x*8), 255} })
+	quadrants := testImage(func(x, y int) color.RGBA {
+		if (x < 16) == (y < 16) {
+			return color.RGBA{255, 255, 255, 255}
+		}
+		return color.RGBA{20, 40, 200, 255}
+	})
+	noisy := testImage(func(x, y int) color.RGBA { return color.RGBA{uint8(y * 8), uint8(255 - y*4), uint8(x * y), 255} })
+
+	// Expected hashes come from the reference encoder (github.com/woltapp/blurhash)
+	tests := []struct {
+		name  string
+		img   image.Image
+		xComp int
+		yComp int
+		want  string
+	}{
+		{"solid 4x3", solid, 4, 3, "L9TI:j|cfQ|c|co1fQo1fQfQfQfQ"},
+		{"solid DC only", solid, 1, 1, "00TI:j"},
+		{"gradient 4x3", gradient, 4, 3, "L.H1y277w%XAofa~jufRfQfQfQfQ"},
+		{"gradient 3x4", gradient, 3, 4, "T.H1y277w%ofa~jufQfQfQofa~ju"},
+		{"quadrants 4x3", quadrants, 4, 3, "L+Lqhwt7fQt7t7~nt6IWfQt6j[WC"},
+		{"quadrants 3x4", quadrants, 3, 4, "T+Lqhwt7fQt7~nt6fQt6j[t7IWWC"},
+		{"noisy 4x3", noisy, 4, 3, "LxH4QrosfMot4FX3fSX8xmj]fTj]"},
+		{"noisy 9x9", noisy, 9, 9, "|xH4QrosfMotfNovfOoyfS4FX3fSX8fTX8fSX4fOxmj]fTj]fPj=fOj[fSXfflfSfhfNfkfTflfObpfTfPfNfSfTfOfNfSovflfOfkfTfgfOfmfQXNfSfOfTfOfOfTfOfRoyfhfRflfNfmfOfkfQX8fOfSfOfSfQfRfQfO"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BlurHash(tt.img, tt.xComp, tt.yComp); got != tt.want {
+				t.Errorf("BlurHash = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlurHashSamplesLargeImages(t *testing.T) {
+	// Scaling an image up by whole pixels doesn't change its sample
+	small := testImage(func(x, y int) color.RGBA { return color.RGBA{uint8(x * 8), 128, uint8(255 - x*8), 255} })
+	large := image.NewRGBA(image.Rect(0, 0, 4*placeholderSampleSize, 4*placeholderSampleSize))
+	for y := 0; y < large.Bounds().Dy(); y++ {
+		for x := 0; x < large.Bounds().Dx(); x++ {
+			large.SetRGBA(x, y, small.RGBAAt(x/4, y/4))
+		}
+	}
+	if got, want := BlurHash(large, 4, 3), BlurHash(small, 4, 3); got != want {
+		t.Errorf("BlurHash of the upscaled image = %s, want %s", got, want)
+	}
+}
+
+func TestDominantColor(t *testing.T) {
+	tests := []struct {
+		name  string
+		pixel func(x, y int) color.RGBA
+		want  string
+	}{
+		{"solid", func(x, y int) color.RGBA { return color.RGBA{18, 52, 86, 255} }, "#123456"},
+		{"larger area wins", func(x, y int) color.RGBA {
+			if x < 20 {
+				return color.RGBA{0, 128, 0, 255}
+			}
+			return color.RGBA{255, 255, 255, 255}
+		}, "#008000"},
+		{"similar colours share a bucket and are averaged", func(x, y int) color.RGBA {
+			switch {
+			case x < 8:
+				return color.RGBA{200, 10, 10, 255}
+			case x < 16:
+				return color.RGBA{204, 14, 14, 255}
+			}
+			// The largest single colour, but split across two buckets
+			if y < 16 {
+				return color.RGBA{0, 0, 255, 255}
+			}
+			return color.RGBA{0, 0, 200, 255}
+		}, "#ca0c0c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DominantColor(testImage(tt.pixel)); got != tt.want {
+				t.Errorf("DominantColor = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
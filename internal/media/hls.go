@@ -0,0 +1,116 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// MasterPlaylistName is the file name of the HLS master playlist
+const MasterPlaylistName = "master.m3u8"
+
+// Rendition is one rung of the HLS bitrate ladder. Height is the length of the
+// video's short side, so portrait and landscape videos get the same ladder.
+type Rendition struct {
+	Name         string
+	Height       int
+	VideoBitrate int // kbit/s
+	AudioBitrate int // kbit/s
+}
+
+// DefaultLadder is the HLS ladder generated for drops
+var DefaultLadder = []Rendition{
+	{Name: "240p", Height: 240, VideoBitrate: 400, AudioBitrate: 64},
+	{Name: "480p", Height: 480, VideoBitrate: 1000, AudioBitrate: 96},
+	{Name: "720p", Height: 720, VideoBitrate: 2500, AudioBitrate: 128},
+}
+
+// even rounds n to the nearest even number, as H.264 requires
+func even(n float64) int {
+	return int(n/2+0.5) * 2
+}
+
+// TranscodeHLS encodes the video at videoPath into an HLS ladder under outDir:
+// one directory per rendition plus MasterPlaylistName. Renditions larger than
+// the source are skipped, but the smallest is always produced.
+func TranscodeHLS(ctx context.Context, videoPath, outDir string, ladder []Rendition) error {
+	meta, err := Probe(ctx, videoPath)
+	if err != nil {
+		return err
+	}
+	input, err := inputArgs(videoPath)
+	if err != nil {
+		return err
+	}
+	w, h := meta.Width, meta.Height
+	short, long := w, h
+	if short > long {
+		short, long = long, short
+	}
+
+	var master strings.Builder
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+
+	for i, r := range ladder {
+		if r.Height > short && i > 0 {
+			break
+		}
+		height := r.Height
+		if height > short {
+			height = short
+		}
+		// Output size keeping the source aspect ratio
+		outShort, outLong := even(float64(height)), even(float64(height)*float64(long)/float64(short))
+		outW, outH := outShort, outLong
+		if w > h {
+			outW, outH = outLong, outShort
+		}
+
+		dir := filepath.Join(outDir, r.Name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+
+		args := append([]string{"-y"}, input...)
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:%d", outW, outH),
+			"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main", "-crf", "23",
+			"-maxrate", fmt.Sprintf("%dk", r.VideoBitrate), "-bufsize", fmt.Sprintf("%dk", 2*r.VideoBitrate),
+			"-g", "48", "-keyint_min", "48", "-sc_threshold", "0",
+			"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", r.AudioBitrate), "-ac", "2",
+			"-hls_time", "4", "-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(dir, "segment_%03d.ts"),
+			filepath.Join(dir, "index.m3u8"),
+		)
+
+		var ffmpegOut bytes.Buffer
+		cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+		cmd.Stderr = &ffmpegOut
+		if err := cmd.Run(); err != nil {
+			log.Println("ffmpeg output:", ffmpegOut.String())
+			return fmt.Errorf("ffmpeg failed for %s: %w", r.Name, err)
+		}
+
+		bandwidth := (r.VideoBitrate + r.AudioBitrate) * 1000
+		fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s/index.m3u8\n", bandwidth, outW, outH, r.Name)
+	}
+
+	return os.WriteFile(filepath.Join(outDir, MasterPlaylistName), []byte(master.String()), 0o644)
+}
+
+// ContentType returns the MIME type for an HLS output file
+func ContentType(name string) string {
+	switch filepath.Ext(name) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,231 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Metadata describes a probed video. Width and Height are display
+// dimensions, i.e. with Rotation already applied.
+type Metadata struct {
+	Format   string  `json:"format"`
+	Duration float64 `json:"duration"` // seconds
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Codec    string  `json:"codec"`
+	FPS      float64 `json:"fps"`
+	Rotation int     `json:"rotation"` // degrees clockwise
+	HasAudio bool    `json:"has_audio"`
+	Size     int64   `json:"size"` // bytes
+}
+
+// ErrNotVideo is returned by Probe for files without a playable video stream
+var ErrNotVideo = errors.New("file is not a video")
+
+// Codecs used by still images, which ffprobe also reports as video streams
+var imageCodecs = map[string]bool{
+	"png": true, "mjpeg": true, "bmp": true, "tiff": true, "webp": true, "gif": true,
+}
+
+// Demuxers uploads may be opened with, by the name passed to -f, and the
+// format_name ffprobe reports for them. Nothing else is ever auto-detected:
+// playlist formats such as HLS or concat make ffmpeg open further URLs and
+// local files named inside the upload.
+var demuxers = map[string]string{
+	"mov":      "mov,mp4,m4a,3gp,3g2,mj2",
+	"matroska": "matroska,webm",
+}
+
+// ebmlMagic starts every Matroska and WebM file
+var ebmlMagic = []byte{0x1a, 0x45, 0xdf, 0xa3}
+
+// demuxer picks the allowed demuxer for the file at path from its first
+// bytes. Anything that isn't Matroska goes to the MP4/QuickTime demuxer,
+// which rejects files it cannot parse.
+func demuxer(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, len(ebmlMagic))
+	if _, err := io.ReadFull(f, head); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if bytes.Equal(head, ebmlMagic) {
+		return "matroska", nil
+	}
+	return "mov", nil
+}
+
+// inputArgs are the ffmpeg and ffprobe arguments that open the local file at
+// path with an allowed demuxer and no protocol other than file
+func inputArgs(path string) ([]string, error) {
+	name, err := demuxer(path)
+	if err != nil {
+		return nil, err
+	}
+	return demuxerArgs(name, path), nil
+}
+
+func demuxerArgs(name, path string) []string {
+	return []string{"-protocol_whitelist", "file", "-f", name, "-i", path}
+}
+
+// parseRate parses an ffprobe frame rate such as "30000/1001"
+func parseRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// Probe inspects the local video file at path with ffprobe
+func Probe(ctx context.Context, path string) (*Metadata, error) {
+	name, err := demuxer(path)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"-v", "error",
+		"-show_entries", "format=format_name,duration,size:stream=codec_type,codec_name,width,height,avg_frame_rate,r_frame_rate,duration:stream_tags=rotate:stream_side_data=rotation",
+		"-of", "json"}, demuxerArgs(name, path)...)
+	out, err := exec.CommandContext(ctx, "ffprobe", args...).Output()
+	if err != nil {
+		// ffprobe exits non-zero for files it cannot parse at all
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, ErrNotVideo
+		}
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var probe struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+			Size       string `json:"size"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType    string `json:"codec_type"`
+			CodecName    string `json:"codec_name"`
+			Width        int    `json:"width"`
+			Height       int    `json:"height"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+			RFrameRate   string `json:"r_frame_rate"`
+			Duration     string `json:"duration"`
+			Tags         struct {
+				Rotate string `json:"rotate"`
+			} `json:"tags"`
+			SideDataList []struct {
+				Rotation int `json:"rotation"`
+			} `json:"side_data_list"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+
+	meta := &Metadata{Format: probe.Format.FormatName}
+	meta.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	meta.Size, _ = strconv.ParseInt(probe.Format.Size, 10, 64)
+
+	foundVideo := false
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "audio":
+			meta.HasAudio = true
+		case "video":
+			if foundVideo || imageCodecs[stream.CodecName] || stream.Width == 0 || stream.Height == 0 {
+				continue
+			}
+			foundVideo = true
+			meta.Codec = stream.CodecName
+			meta.Width, meta.Height = stream.Width, stream.Height
+			meta.FPS = parseRate(stream.AvgFrameRate)
+			if meta.FPS == 0 {
+				meta.FPS = parseRate(stream.RFrameRate)
+			}
+			if meta.Duration == 0 {
+				meta.Duration, _ = strconv.ParseFloat(stream.Duration, 64)
+			}
+
+			rotation, _ := strconv.Atoi(stream.Tags.Rotate)
+			for _, sd := range stream.SideDataList {
+				if sd.Rotation != 0 {
+					// Display matrix rotation is counter-clockwise
+					rotation = -sd.Rotation
+				}
+			}
+			meta.Rotation = ((rotation % 360) + 360) % 360
+			if meta.Rotation%180 != 0 {
+				meta.Width, meta.Height = meta.Height, meta.Width
+			}
+		}
+	}
+
+	if !foundVideo || meta.Duration <= 0 || meta.Format != demuxers[name] {
+		return nil, ErrNotVideo
+	}
+	return meta, nil
+}
+
+// FileType returns the file extension and MIME type a video in meta's
+// container is stored and served with
+func (m *Metadata) FileType() (string, string) {
+	if m.Format == demuxers["matroska"] {
+		return ".webm", "video/webm"
+	}
+	return ".mp4", "video/mp4"
+}
+
+// Limits bounds what a user may upload
+type Limits struct {
+	MaxDuration  float64 // seconds
+	MaxShortSide int     // pixels, e.g. 1080 for 1080p
+}
+
+// Upload limits per user tier
+var tierLimits = map[string]Limits{
+	"free":    {MaxDuration: 60, MaxShortSide: 1080},
+	"premium": {MaxDuration: 300, MaxShortSide: 2160},
+}
+
+// LimitsForTier returns the upload limits for tier, defaulting to the free tier
+func LimitsForTier(tier string) Limits {
+	if l, ok := tierLimits[tier]; ok {
+		return l
+	}
+	return tierLimits["free"]
+}
+
+// Validate checks meta against l, returning a user-facing error
+func (l Limits) Validate(meta *Metadata) error {
+	if l.MaxDuration > 0 && meta.Duration > l.MaxDuration {
+		return fmt.Errorf("video is %.0f seconds long; the limit for your plan is %.0f seconds", meta.Duration, l.MaxDuration)
+	}
+	short := meta.Width
+	if meta.Height < short {
+		short = meta.Height
+	}
+	if l.MaxShortSide > 0 && short > l.MaxShortSide {
+		return fmt.Errorf("video resolution %dx%d exceeds the %dp limit for your plan", meta.Width, meta.Height, l.MaxShortSide)
+	}
+	return nil
+}
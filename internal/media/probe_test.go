@@ -0,0 +1,57 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDemuxer(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{"Matroska", "\x1a\x45\xdf\xa3\x01\x00\x00\x00", "matroska"},
+		{"MP4", "\x00\x00\x00\x18ftypmp42", "mov"},
+		{"HLS playlist", "#EXTM3U\n#EXT-X-VERSION:3\n", "mov"},
+		{"concat script", "ffconcat version 1.0\nfile /etc/passwd\n", "mov"},
+		{"shorter than the magic", "\x1a\x45", "mov"},
+		{"empty", "", "mov"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "upload.m3u8")
+			if err := os.WriteFile(path, []byte(tt.head), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := demuxer(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("demuxer = %s, want %s", got, tt.want)
+			}
+			if _, ok := demuxers[got]; !ok {
+				t.Errorf("%s is not an allowed demuxer", got)
+			}
+		})
+	}
+}
+
+func TestFileType(t *testing.T) {
+	tests := []struct {
+		format   string
+		wantExt  string
+		wantType string
+	}{
+		{"mov,mp4,m4a,3gp,3g2,mj2", ".mp4", "video/mp4"},
+		{"matroska,webm", ".webm", "video/webm"},
+	}
+	for _, tt := range tests {
+		ext, contentType := (&Metadata{Format: tt.format}).FileType()
+		if ext != tt.wantExt || contentType != tt.wantType {
+			t.Errorf("FileType(%s) = %s, %s, want %s, %s", tt.format, ext, contentType, tt.wantExt, tt.wantType)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Candidate is a possible thumbnail frame
+type Candidate struct {
+	Path      string
+	Timestamp float64 // seconds into the video
+	Score     float64
+}
+
+// GenerateThumbnail writes a single JPEG frame from t seconds into the video
+// at videoPath to thumbPath. ffmpeg's thumbnail filter picks the most
+// representative frame from a short window starting at t, which avoids
+// landing on a transition or motion-blurred frame.
+func GenerateThumbnail(ctx context.Context, videoPath, thumbPath string, t float64) error {
+	input, err := inputArgs(videoPath)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"-y", "-ss", strconv.FormatFloat(t, 'f', 3, 64)}, input...)
+	args = append(args, "-vf", "thumbnail=24", "-frames:v", "1", "-q:v", "3", thumbPath)
+
+	var ffmpegOut bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = &ffmpegOut
+	if err := cmd.Run(); err != nil {
+		log.Println("ffmpeg output:", ffmpegOut.String())
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	// ffmpeg exits successfully without output when t is past the last frame
+	if fi, err := os.Stat(thumbPath); err != nil || fi.Size() == 0 {
+		return fmt.Errorf("ffmpeg produced no frame at %.3fs", t)
+	}
+	return nil
+}
+
+// GenerateCandidates extracts up to n thumbnail candidates spread across a
+// video of the given duration into outDir, best first. Very short clips
+// still get at least one candidate taken from their first frame.
+func GenerateCandidates(ctx context.Context, videoPath, outDir string, duration float64, n int) ([]Candidate, error) {
+	candidates := []Candidate{}
+	for i := 0; i < n; i++ {
+		// Sample the middle of n equal slices, e.g. 10%, 30%, 50%... for n=5
+		t := duration * (float64(i) + 0.5) / float64(n)
+		p := filepath.Join(outDir, fmt.Sprintf("candidate-%d.jpg", i))
+		if err := GenerateThumbnail(ctx, videoPath, p, t); err != nil {
+			log.Println("Skipping thumbnail candidate:", err)
+			continue
+		}
+		score, err := scoreFile(p)
+		if err != nil {
+			log.Println("Skipping thumbnail candidate:", err)
+			continue
+		}
+		candidates = append(candidates, Candidate{Path: p, Timestamp: t, Score: score})
+	}
+
+	if len(candidates) == 0 {
+		p := filepath.Join(outDir, "candidate-0.jpg")
+		if err := GenerateThumbnail(ctx, videoPath, p, 0); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, Candidate{Path: p})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates, nil
+}
+
+func scoreFile(p string) (float64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+	return ScoreFrame(img), nil
+}
+
+// ScoreFrame rates how good img is as a thumbnail. It favours frames that
+// are neither too dark nor blown out, have contrast, and are sharp.
+func ScoreFrame(img image.Image) float64 {
+	b := img.Bounds()
+	const grid = 64
+	stepX := max(b.Dx()/grid, 1)
+	stepY := max(b.Dy()/grid, 1)
+
+	luma := func(x, y int) float64 {
+		r, g, bl, _ := img.At(x, y).RGBA()
+		return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)) / 65535
+	}
+
+	var sum, sumSq, edges float64
+	var count, edgeCount int
+	for y := b.Min.Y; y < b.Max.Y; y += stepY {
+		for x := b.Min.X; x < b.Max.X; x += stepX {
+			l := luma(x, y)
+			sum += l
+			sumSq += l * l
+			count++
+			// Gradient to the next sample approximates sharpness
+			if x+stepX < b.Max.X && y+stepY < b.Max.Y {
+				edges += math.Abs(l-luma(x+stepX, y)) + math.Abs(l-luma(x, y+stepY))
+				edgeCount++
+			}
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+
+	mean := sum / float64(count)
+	contrast := math.Sqrt(math.Max(sumSq/float64(count)-mean*mean, 0))
+	sharpness := 0.0
+	if edgeCount > 0 {
+		sharpness = edges / float64(edgeCount)
+	}
+	// 1 at mid-grey, 0 for pure black or white
+	exposure := 1 - math.Abs(mean-0.5)*2
+
+	return exposure + 2*contrast + 4*sharpness
+}
+
+// GeneratePreview writes a short, muted, looping MP4 of the video starting at
+// start seconds, sized for feed tiles
+func GeneratePreview(ctx context.Context, videoPath, outPath string, start, length float64) error {
+	input, err := inputArgs(videoPath)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"-y",
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64), "-t", strconv.FormatFloat(length, 'f', 3, 64)}, input...)
+	args = append(args, "-an",
+		"-vf", "scale='if(gt(iw,ih),-2,320)':'if(gt(iw,ih),320,-2)',fps=15",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "28", "-pix_fmt", "yuv420p",
+		"-movflags", "+faststart", outPath)
+
+	var ffmpegOut bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = &ffmpegOut
+	if err := cmd.Run(); err != nil {
+		log.Println("ffmpeg output:", ffmpegOut.String())
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	return nil
+}
+
+// PreviewWindow picks a preview of at most maxLength seconds centred on t,
+// kept inside a video of the given duration
+func PreviewWindow(t, duration, maxLength float64) (float64, float64) {
+	length := math.Min(maxLength, duration)
+	start := t - length/2
+	start = math.Max(0, math.Min(start, duration-length))
+	return start, length
+}
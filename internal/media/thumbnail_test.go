@@ -0,0 +1,96 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func fill(w, h int, pixel func(x, y int) color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, pixel(x, y))
+		}
+	}
+	return img
+}
+
+func TestScoreFrame(t *testing.T) {
+	grey := color.RGBA{128, 128, 128, 255}
+	tests := []struct {
+		name string
+		img  image.Image
+		want float64
+	}{
+		{"black frame", fill(640, 360, func(x, y int) color.RGBA { return black }), 0},
+		{"white frame", fill(640, 360, func(x, y int) color.RGBA { return white }), 0},
+		{"flat grey", fill(640, 360, func(x, y int) color.RGBA { return grey }), 1 - math.Abs(128.0/255-0.5)*2},
+		{"single pixel", fill(1, 1, func(x, y int) color.RGBA { return grey }), 1 - math.Abs(128.0/255-0.5)*2},
+		// 10px squares line up with the 64-sample grid, so every sample sits
+		// next to its opposite: full contrast and maximum sharpness
+		{"checkerboard", fill(640, 640, func(x, y int) color.RGBA {
+			if (x/10+y/10)%2 == 0 {
+				return black
+			}
+			return white
+		}), 1 + 2*0.5 + 4*2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ScoreFrame(tt.img); math.Abs(got-tt.want) > 1e-3 {
+				t.Errorf("ScoreFrame = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreFrameRanking(t *testing.T) {
+	// From worst to best thumbnail
+	frames := []struct {
+		name string
+		img  image.Image
+	}{
+		{"black", fill(640, 360, func(x, y int) color.RGBA { return black })},
+		{"mostly black", fill(640, 360, func(x, y int) color.RGBA {
+			if x < 600 {
+				return black
+			}
+			return white
+		})},
+		{"soft gradient", fill(640, 360, func(x, y int) color.RGBA {
+			v := uint8(x * 255 / 639)
+			return color.RGBA{v, v, v, 255}
+		})},
+		{"sharp stripes", stripes(640, 360, black, white, black, white, black, white, black, white)},
+	}
+	for i := 1; i < len(frames); i++ {
+		prev, cur := ScoreFrame(frames[i-1].img), ScoreFrame(frames[i].img)
+		if cur <= prev {
+			t.Errorf("%s scored %f, want more than %s at %f", frames[i].name, cur, frames[i-1].name, prev)
+		}
+	}
+}
+
+func TestPreviewWindow(t *testing.T) {
+	tests := []struct {
+		name                  string
+		t, duration, max      float64
+		wantStart, wantLength float64
+	}{
+		{"sub-second clip", 0.25, 0.5, 3, 0, 0.5},
+		{"clip shorter than a preview", 2, 2.5, 3, 0, 2.5},
+		{"centred in a long video", 30, 120, 3, 28.5, 3},
+		{"clamped to the start", 0.5, 120, 3, 0, 3},
+		{"clamped to the end", 119.5, 120, 3, 117, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, length := PreviewWindow(tt.t, tt.duration, tt.max)
+			if start != tt.wantStart || length != tt.wantLength {
+				t.Errorf("PreviewWindow = (%v, %v), want (%v, %v)", start, length, tt.wantStart, tt.wantLength)
+			}
+		})
+	}
+}
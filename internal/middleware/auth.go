@@ -2,17 +2,28 @@
 package middleware
 
 import (
-	"fmt"
+	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+	"github.com/richiethie/BitDrop.Server/internal/utils"
 )
 
+// AuthMiddleware authenticates requests with a Bearer access token
 func AuthMiddleware() gin.HandlerFunc {
+	return authMiddleware(false)
+}
+
+// APIKeyAuthMiddleware also accepts personal API keys. Routes behind it must
+// declare the scope they need with RequireScope.
+func APIKeyAuthMiddleware() gin.HandlerFunc {
+	return authMiddleware(true)
+}
+
+func authMiddleware(allowAPIKeys bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -26,37 +37,32 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		var token *jwt.Token
-		var err error
-
-		// Attempt verification with custom JWT secret
-		customSecret := os.Getenv("JWT_SECRET")
-		token, err = jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		if services.IsAPIKey(tokenString) {
+			if !allowAPIKeys {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API keys can't be used for this endpoint"})
+				return
 			}
-			return []byte(customSecret), nil
-		})
-
-		// If custom JWT fails, try Supabase secret
-		if err != nil || !token.Valid {
-			supabaseSecret := os.Getenv("SUPABASE_JWT_SECRET")
-			token, err = jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return []byte(supabaseSecret), nil
-			})
-		}
-
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			key, err := services.AuthenticateAPIKey(c.Request.Context(), tokenString, c.ClientIP())
+			if err == services.ErrInvalidAPIKey {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			if err != nil {
+				log.Printf("❌ Error checking API key: %v", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return
+			}
+			c.Set("apiKeyId", key.ID)
+			c.Set("apiKeyScopes", key.Scopes)
+			c.Set("userId", key.UserID)
+			c.Next()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// Our own tokens are checked against our key set, Supabase's against its JWKS
+		claims, err := utils.ParseJWT(c.Request.Context(), tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			return
 		}
 
@@ -77,6 +83,36 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Users signed in through Supabase get a users row on their first request
+		if iss, _ := claims["iss"].(string); iss != utils.JWTIssuer() {
+			email, _ := claims["email"].(string)
+			err := services.EnsureUser(userId, email)
+			if err == services.ErrAccountExists {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "An account with this email already exists"})
+				return
+			}
+			if err != nil {
+				log.Printf("❌ Error provisioning user %s: %v", userId, err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return
+			}
+		}
+
+		// Tokens we issued carry the session they belong to; reject revoked sessions
+		if sid, ok := claims["sid"].(string); ok && sid != "" {
+			active, err := services.SessionActive(c.Request.Context(), sid)
+			if err != nil {
+				log.Printf("❌ Error checking session: %v", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return
+			}
+			if !active {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+				return
+			}
+			c.Set("sessionId", sid)
+		}
+
 		c.Set("userId", userId)
 		c.Next()
 	}
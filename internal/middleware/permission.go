@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/richiethie/BitDrop.Server/internal/rbac"
+)
+
+// RequirePermission only lets through callers who hold perm globally.
+// It must run after AuthMiddleware.
+func RequirePermission(perm rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		grants, err := rbac.ForRequest(c)
+		if err != nil {
+			log.Printf("❌ Error loading permissions: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if !grants.Has(perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have permission to do this"})
+			return
+		}
+		c.Next()
+	}
+}
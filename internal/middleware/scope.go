@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope checks that a request authenticated with an API key was
+// granted scope. Requests with a user access token aren't restricted.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, isKey := c.Get("apiKeyScopes")
+		if isKey && !slices.Contains(scopes.([]string), scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key is missing the " + scope + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
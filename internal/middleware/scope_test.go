@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		scopes []string // nil means the request used an access token
+		want   int
+	}{
+		{"access token", nil, http.StatusOK},
+		{"key with the scope", []string{"drops:read", "drops:write"}, http.StatusOK},
+		{"key without the scope", []string{"drops:read", "profile:read"}, http.StatusForbidden},
+		{"key with no scopes", []string{}, http.StatusForbidden},
+		{"scope names match exactly", []string{"drops:write:extra", "DROPS:WRITE"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST("/drops", func(c *gin.Context) {
+				if tt.scopes != nil {
+					c.Set("apiKeyScopes", tt.scopes)
+				}
+			}, RequireScope("drops:write"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/drops", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareRejectsAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/account", AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"API key on a user-only route", "Bearer bd_abcdefgh_secret", http.StatusForbidden},
+		{"missing header", "", http.StatusUnauthorized},
+		{"not a bearer token", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/account", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
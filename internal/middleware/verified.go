@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+// RequireVerifiedEmail blocks users who haven't confirmed their email address
+// when REQUIRE_EMAIL_VERIFICATION=true. It must run after AuthMiddleware.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if os.Getenv("REQUIRE_EMAIL_VERIFICATION") != "true" {
+			c.Next()
+			return
+		}
+
+		var verified bool
+		err := db.DB.QueryRow(c.Request.Context(), `
+			SELECT email_verified FROM users WHERE id = $1
+		`, c.GetString("userId")).Scan(&verified)
+		if err != nil {
+			log.Printf("❌ Error checking email verification: %v", err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+		if !verified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Please verify your email address first"})
+			return
+		}
+		c.Next()
+	}
+}
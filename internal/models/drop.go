@@ -7,14 +7,88 @@ import (
 )
 
 type Drop struct {
-	ID        uuid.UUID  `json:"id" db:"id"`
-	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
-	GroupID   *uuid.UUID `json:"group_id,omitempty" db:"group_id"` // optional: for group drops
-	VideoURL  string     `json:"video_url" db:"video_url"`
-	Thumbnail string     `json:"thumbnail" db:"thumbnail"` // store preview image
-	Caption   string     `json:"caption,omitempty" db:"caption"`
-	CreatedAt time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
-	Votes     int        `json:"votes" db:"votes"`
-	Visibility string    `json:"visibility" db:"visibility"` // "private", "public", or "shared"
+	ID                     uuid.UUID  `json:"id" db:"id"`
+	UserID                 uuid.UUID  `json:"user_id" db:"user_id"`
+	GroupID                *uuid.UUID `json:"group_id,omitempty" db:"group_id"` // optional: for group drops
+	VideoURL               string     `json:"video_url" db:"video_url"`
+	VideoKey               string     `json:"-" db:"video_key"`         // object store key for the video
+	Thumbnail              string     `json:"thumbnail" db:"thumbnail"` // store preview image
+	ThumbnailKey           string     `json:"-" db:"thumbnail_key"`
+	BlurHash               string     `json:"blurhash,omitempty" db:"blurhash"`                         // placeholder for the thumbnail
+	DominantColor          string     `json:"dominant_color,omitempty" db:"dominant_color"`             // "#rrggbb"
+	ThumbnailCandidates    []string   `json:"thumbnail_candidates,omitempty" db:"thumbnail_candidates"` // best first
+	ThumbnailCandidateKeys []string   `json:"-" db:"thumbnail_candidate_keys"`
+	PreviewURL             string     `json:"preview_url,omitempty" db:"preview_url"` // short muted MP4 loop
+	PreviewKey             string     `json:"-" db:"preview_key"`
+	PlaylistURL            string     `json:"playlist_url,omitempty" db:"playlist_url"` // HLS master playlist
+	PlaylistKey            string     `json:"-" db:"playlist_key"`
+	Caption                string     `json:"caption,omitempty" db:"caption"`
+	CreatedAt              time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at" db:"updated_at"`
+	Votes                  int        `json:"votes" db:"votes"`
+	Visibility             string     `json:"visibility" db:"visibility"` // "private", "public", or "shared"
+	Status                 string     `json:"status" db:"status"`         // "processing", "ready", or "failed"
+	MediaPrivate           bool       `json:"-" db:"media_private"`       // media lives in the private store
+	MediaExpiresAt         *time.Time `json:"media_expires_at,omitempty"` // when signed media URLs expire
+
+	// Video metadata from ffprobe; Width and Height are display dimensions
+	Duration float64 `json:"duration" db:"duration"` // seconds
+	Width    int     `json:"width" db:"width"`
+	Height   int     `json:"height" db:"height"`
+	Codec    string  `json:"codec" db:"codec"`
+	FPS      float64 `json:"fps" db:"fps"`
+	Rotation int     `json:"rotation" db:"rotation"`
+	FileSize int64   `json:"file_size" db:"file_size"` // bytes
+}
+
+// Drop processing statuses
+const (
+	DropStatusProcessing = "processing"
+	DropStatusReady      = "ready"
+	DropStatusFailed     = "failed"
+)
+
+// Drop visibilities. Shared drops are visible to the users on their share list.
+const (
+	DropVisibilityPrivate = "private"
+	DropVisibilityPublic  = "public"
+	DropVisibilityShared  = "shared"
+)
+
+// ValidDropVisibility reports whether v is one of the drop visibilities
+func ValidDropVisibility(v string) bool {
+	return v == DropVisibilityPrivate || v == DropVisibilityPublic || v == DropVisibilityShared
+}
+
+// UpdateVisibilityRequest changes who can see a drop
+type UpdateVisibilityRequest struct {
+	Visibility string `json:"visibility" binding:"required"`
+}
+
+// ShareDropRequest adds users to a shared drop's share list
+type ShareDropRequest struct {
+	Usernames []string `json:"usernames" binding:"required"`
+}
+
+// DropShare is a user a drop is shared with
+type DropShare struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	AvatarURL string    `json:"avatar_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SelectThumbnailRequest picks one of a drop's thumbnail candidates
+type SelectThumbnailRequest struct {
+	Index *int `json:"index" binding:"required"`
+}
+
+// UploadURLRequest asks for a pre-signed URL to upload a drop's video directly to storage
+type UploadURLRequest struct {
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Caption     string `json:"caption"`
+	GroupID     string `json:"group_id"`
+	Visibility  string `json:"visibility"`
 }
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Identity is an external login (OIDC provider account) linked to a user
+type Identity struct {
+	ID          string     `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+type OIDCStartRequest struct {
+	DeviceName string `json:"device_name" binding:"max=100"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
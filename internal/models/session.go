@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session is one logged-in device. Its ID is shared with the refresh token
+// family issued at login and the `sid` claim of its access tokens.
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
@@ -1,16 +1,66 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type User struct {
-	ID         string    `json:"id"`
-	Email      string    `json:"email"`
-	Username   string    `json:"username"`
-	AvatarURL  string    `json:"avatar_url"`
-	Bio        string    `json:"bio"`
-	Tier       string    `json:"tier"`
-	BoostsLeft int       `json:"boosts_left"`
-	IsAdmin    bool      `json:"is_admin"`
-	CreatedAt  time.Time `json:"created_at"`
-	LastActive time.Time `json:"last_active"`
+	ID              string    `json:"id"`
+	Email           string    `json:"email"`
+	EmailVerified   bool      `json:"email_verified"`
+	Username        string    `json:"username"`
+	DisplayName     string    `json:"display_name"`
+	AvatarURL       string    `json:"avatar_url"`
+	Bio             string    `json:"bio"`
+	Tier            string    `json:"tier"`
+	BoostsLeft      int       `json:"boosts_left"`
+	IsAdmin         bool      `json:"is_admin"`
+	NeedsOnboarding bool      `json:"needs_onboarding"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastActive      time.Time `json:"last_active"`
+
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+}
+
+type AssignRoleRequest struct {
+	Role    string     `json:"role" binding:"required"`
+	GroupID *uuid.UUID `json:"group_id"`
+}
+
+type OnboardingRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// PublicProfile is what other users can see of an account. The counts only
+// include drops the viewer can see.
+type PublicProfile struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	Bio         string    `json:"bio"`
+	Tier        string    `json:"tier"`
+	Badge       string    `json:"badge,omitempty"` // set for paid tiers
+	CreatedAt   time.Time `json:"created_at"`
+	DropCount   int       `json:"drop_count"`
+	TotalVotes  int       `json:"total_votes"`
+}
+
+// UpdateProfileRequest changes only the fields that are present
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	Username    *string `json:"username"`
+}
+
+type UsernameChange struct {
+	OldUsername string    `json:"old_username"`
+	NewUsername string    `json:"new_username"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
 }
@@ -0,0 +1,211 @@
+// Package oidctest runs a minimal OpenID Connect provider for tests: it
+// serves discovery, a JWKS and a token endpoint that checks PKCE.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Issuer is a mock identity provider. Its issuer URL is Server.URL.
+type Issuer struct {
+	Server   *httptest.Server
+	ClientID string
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	kid    string
+	grants map[string]grant
+}
+
+// grant is an authorization code waiting to be exchanged
+type grant struct {
+	challenge   string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+// NewIssuer starts an issuer for clientID. Close it when done.
+func NewIssuer(clientID string) (*Issuer, error) {
+	iss := &Issuer{ClientID: clientID, grants: map[string]grant{}}
+	if err := iss.RotateKey(); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", iss.discovery)
+	mux.HandleFunc("/jwks", iss.jwks)
+	mux.HandleFunc("/token", iss.token)
+	iss.Server = httptest.NewServer(mux)
+	return iss, nil
+}
+
+// URL is the issuer identifier
+func (iss *Issuer) URL() string {
+	return iss.Server.URL
+}
+
+// Close shuts the issuer down
+func (iss *Issuer) Close() {
+	iss.Server.Close()
+}
+
+// RotateKey replaces the signing key with a new one under a new kid. The old
+// key is dropped from the JWKS.
+func (iss *Issuer) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return err
+	}
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.key, iss.kid = key, base64.RawURLEncoding.EncodeToString(kid)
+	return nil
+}
+
+// Authorize plays the user signing in at the provider: it checks the
+// authorization URL a relying party built and returns the code the provider
+// would redirect back with. The ID token gets the usual claims for the
+// request, including its nonce; claims adds to or overrides them.
+func (iss *Issuer) Authorize(authURL string, claims jwt.MapClaims) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	switch {
+	case q.Get("response_type") != "code":
+		return "", errors.New("response_type must be code")
+	case q.Get("client_id") != iss.ClientID:
+		return "", errors.New("unknown client_id")
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		return "", errors.New("PKCE with S256 is required")
+	case q.Get("state") == "" || q.Get("nonce") == "":
+		return "", errors.New("state and nonce are required")
+	case !strings.Contains(" "+q.Get("scope")+" ", " openid "):
+		return "", errors.New("the openid scope is required")
+	}
+
+	full := jwt.MapClaims{
+		"iss":   iss.URL(),
+		"aud":   iss.ClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	code := make([]byte, 16)
+	if _, err := rand.Read(code); err != nil {
+		return "", err
+	}
+	c := base64.RawURLEncoding.EncodeToString(code)
+	iss.mu.Lock()
+	iss.grants[c] = grant{challenge: q.Get("code_challenge"), redirectURI: q.Get("redirect_uri"), claims: full}
+	iss.mu.Unlock()
+	return c, nil
+}
+
+// Sign signs claims as an ID token with the current key
+func (iss *Issuer) Sign(claims jwt.MapClaims) (string, error) {
+	iss.mu.Lock()
+	key, kid := iss.key, iss.kid
+	iss.mu.Unlock()
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = kid
+	return t.SignedString(key)
+}
+
+// PublicKey is the current signing key's public half
+func (iss *Issuer) PublicKey() *rsa.PublicKey {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	return &iss.key.PublicKey
+}
+
+func (iss *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 iss.URL(),
+		"authorization_endpoint": iss.URL() + "/authorize",
+		"token_endpoint":         iss.URL() + "/token",
+		"jwks_uri":               iss.URL() + "/jwks",
+	})
+}
+
+func (iss *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	iss.mu.Lock()
+	key, kid := iss.key, iss.kid
+	iss.mu.Unlock()
+	enc := base64.RawURLEncoding.EncodeToString
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   enc(key.N.Bytes()),
+		"e":   enc(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+}
+
+func (iss *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	code := r.PostForm.Get("code")
+	iss.mu.Lock()
+	g, ok := iss.grants[code]
+	delete(iss.grants, code) // codes are single use
+	iss.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	case r.PostForm.Get("client_id") != iss.ClientID:
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	case !ok, r.PostForm.Get("redirect_uri") != g.redirectURI,
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := iss.Sign(g.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
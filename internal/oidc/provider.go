@@ -0,0 +1,201 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownProvider is returned for provider names that aren't configured
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Provider is an OpenID Connect identity provider we act as a relying party for
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	mu        sync.Mutex
+	discovery *discoveryDoc
+	keys      *KeySet
+}
+
+// discoveryDoc is the subset of /.well-known/openid-configuration we use
+type discoveryDoc struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+var providers = map[string]*Provider{}
+
+// Init loads providers from OIDC_PROVIDERS, a comma-separated list of names.
+// Each name is configured with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL and optionally _SCOPES (space separated). Any issuer that
+// serves a discovery document works, including a local mock issuer.
+func Init() error {
+	providers = map[string]*Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		env := func(key string) string {
+			return os.Getenv("OIDC_" + strings.ToUpper(name) + "_" + key)
+		}
+
+		p := &Provider{
+			Name:         name,
+			Issuer:       strings.TrimRight(env("ISSUER"), "/"),
+			ClientID:     env("CLIENT_ID"),
+			ClientSecret: env("CLIENT_SECRET"),
+			RedirectURL:  env("REDIRECT_URL"),
+			Scopes:       strings.Fields(env("SCOPES")),
+		}
+		if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return fmt.Errorf("OIDC provider %q needs ISSUER, CLIENT_ID and REDIRECT_URL", name)
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{"openid", "email", "profile"}
+		}
+		providers[name] = p
+		fmt.Printf("🔑 OIDC provider %s enabled (%s)\n", name, p.Issuer)
+	}
+	return nil
+}
+
+// Get returns the configured provider called name
+func Get(name string) (*Provider, error) {
+	p, ok := providers[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// discover fetches and caches the provider's discovery document
+func (p *Provider) discover(ctx context.Context) (*discoveryDoc, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc discoveryDoc
+	if err := getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("discovery failed for %s: %w", p.Name, err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery for %s returned issuer %q", p.Name, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery for %s is missing endpoints", p.Name)
+	}
+	p.discovery = &doc
+	p.keys = NewKeySet(doc.JWKSURI)
+	return p.discovery, nil
+}
+
+// AuthCodeURL returns the URL to send the user to, using PKCE with the S256 method
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientID)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("scope", strings.Join(p.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", CodeChallenge(codeVerifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the ID token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("%w: %s %s", ErrExchangeFailed, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("%w: no id_token in response", ErrExchangeFailed)
+	}
+	return body.IDToken, nil
+}
+
+// ErrExchangeFailed is returned when the provider rejects the authorization code
+var ErrExchangeFailed = errors.New("authorization code exchange failed")
+
+func getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
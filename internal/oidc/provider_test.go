@@ -0,0 +1,218 @@
+package oidc
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/richiethie/BitDrop.Server/internal/oidc/oidctest"
+)
+
+const testClientID = "bitdrop-test"
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Issuer) {
+	t.Helper()
+	iss, err := oidctest.NewIssuer(testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(iss.Close)
+	p := &Provider{
+		Name:        "mock",
+		Issuer:      iss.URL(),
+		ClientID:    testClientID,
+		RedirectURL: "https://app.example/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	}
+	return p, iss
+}
+
+// signIn runs the flow up to the ID token: it builds the authorization URL,
+// has the issuer authorize it with claims and exchanges the code
+func signIn(t *testing.T, p *Provider, iss *oidctest.Issuer, claims jwt.MapClaims) (idToken, nonce string) {
+	t.Helper()
+	ctx := context.Background()
+	nonce, _ = RandomString(32)
+	verifier, _ := RandomString(48)
+	authURL, err := p.AuthCodeURL(ctx, "state-1", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := iss.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err = p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idToken, nonce
+}
+
+func TestProviderFlow(t *testing.T) {
+	p, iss := newTestProvider(t)
+	idToken, nonce := signIn(t, p, iss, jwt.MapClaims{
+		"sub":            "user-123",
+		"email":          "Alice@Example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	})
+
+	claims, err := p.VerifyIDToken(context.Background(), idToken, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Claims{Subject: "user-123", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if *claims != want {
+		t.Errorf("claims = %+v, want %+v", *claims, want)
+	}
+}
+
+func TestAuthCodeURLUsesPKCE(t *testing.T) {
+	p, _ := newTestProvider(t)
+	authURL, err := p.AuthCodeURL(context.Background(), "st", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if q.Get("code_challenge") != CodeChallenge("verifier") || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("PKCE parameters = %q %q", q.Get("code_challenge"), q.Get("code_challenge_method"))
+	}
+	if q.Get("state") != "st" || q.Get("nonce") != "nonce" || q.Get("redirect_uri") != p.RedirectURL {
+		t.Errorf("authorization URL = %s", authURL)
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// Example from RFC 7636 appendix B
+	got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("CodeChallenge = %s, want %s", got, want)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	p, iss := newTestProvider(t)
+	ctx := context.Background()
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "the-real-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := iss.Authorize(authURL, jwt.MapClaims{"sub": "user-123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(ctx, code, "a-stolen-code-without-the-verifier"); !errors.Is(err, ErrExchangeFailed) {
+		t.Errorf("err = %v, want ErrExchangeFailed", err)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	p, iss := newTestProvider(t)
+	ctx := context.Background()
+	// Loads discovery and the key set
+	signIn(t, p, iss, jwt.MapClaims{"sub": "warm-up"})
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   iss.URL(),
+			"aud":   testClientID,
+			"sub":   "user-123",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "expected-nonce",
+		}
+	}
+	signed := func(change func(jwt.MapClaims)) string {
+		c := valid()
+		change(c)
+		raw, err := iss.Sign(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(iss.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacWithPublicKey, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString(pubDER)
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"bad nonce", signed(func(c jwt.MapClaims) { c["nonce"] = "attacker-nonce" })},
+		{"missing nonce", signed(func(c jwt.MapClaims) { delete(c, "nonce") })},
+		{"bad aud", signed(func(c jwt.MapClaims) { c["aud"] = "some-other-client" })},
+		{"bad iss", signed(func(c jwt.MapClaims) { c["iss"] = "https://evil.example" })},
+		{"expired", signed(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() })},
+		{"no expiry", signed(func(c jwt.MapClaims) { delete(c, "exp") })},
+		{"missing sub", signed(func(c jwt.MapClaims) { delete(c, "sub") })},
+		{"HS256 keyed with the public key", hmacWithPublicKey},
+		{"alg none", unsigned},
+		{"garbage", "not.a.jwt"},
+	}
+	if _, err := p.VerifyIDToken(ctx, signed(func(jwt.MapClaims) {}), "expected-nonce"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.VerifyIDToken(ctx, tt.raw, "expected-nonce"); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("err = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenEmailVerifiedString(t *testing.T) {
+	p, iss := newTestProvider(t)
+	for _, v := range []struct {
+		claim any
+		want  bool
+	}{{"true", true}, {"false", false}, {true, true}, {nil, false}} {
+		claims := jwt.MapClaims{"sub": "apple-user", "email": "a@example.com"}
+		if v.claim != nil {
+			claims["email_verified"] = v.claim
+		}
+		idToken, nonce := signIn(t, p, iss, claims)
+		c, err := p.VerifyIDToken(context.Background(), idToken, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.EmailVerified != v.want {
+			t.Errorf("email_verified %v: EmailVerified = %v, want %v", v.claim, c.EmailVerified, v.want)
+		}
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	p, iss := newTestProvider(t)
+	ctx := context.Background()
+	idToken, nonce := signIn(t, p, iss, jwt.MapClaims{"sub": "user-123"})
+	if _, err := p.VerifyIDToken(ctx, idToken, nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := iss.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	idToken, nonce = signIn(t, p, iss, jwt.MapClaims{"sub": "user-123"})
+
+	// Unknown kids don't trigger a refetch right after the last one
+	if _, err := p.VerifyIDToken(ctx, idToken, nonce); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken before the refresh interval", err)
+	}
+	p.keys.mu.Lock()
+	p.keys.fetched = time.Now().Add(-jwksMinRefresh)
+	p.keys.mu.Unlock()
+	if _, err := p.VerifyIDToken(ctx, idToken, nonce); err != nil {
+		t.Errorf("token signed with the rotated key rejected: %v", err)
+	}
+}
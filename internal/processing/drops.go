@@ -0,0 +1,310 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/jobs"
+	"github.com/richiethie/BitDrop.Server/internal/media"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+)
+
+// Job kinds for drops
+const (
+	JobProcessDrop   = "process_drop"    // thumbnail; marks the drop ready
+	JobTranscodeDrop = "transcode_drop"  // HLS ladder; adds the playlist URL
+	JobMoveDropMedia = "move_drop_media" // moves media between the public and private stores
+)
+
+const (
+	thumbnailCandidates = 4
+	previewLength       = 3.0 // seconds
+)
+
+type processDropPayload struct {
+	DropID uuid.UUID `json:"drop_id"`
+}
+
+// RegisterHandlers installs the media-processing job handlers
+func RegisterHandlers() {
+	jobs.Register(JobProcessDrop, jobs.Handler{Run: processDrop, OnFailure: failDrop})
+	jobs.Register(JobTranscodeDrop, jobs.Handler{Run: transcodeDrop})
+	jobs.Register(JobMoveDropMedia, jobs.Handler{Run: moveDropMedia})
+}
+
+// EnqueueDrop schedules processing for dropID. Pass the transaction that
+// inserted the drop so the job only exists if the drop does.
+func EnqueueDrop(ctx context.Context, e db.Execer, dropID uuid.UUID) error {
+	payload := processDropPayload{DropID: dropID}
+	if err := jobs.Enqueue(ctx, e, JobProcessDrop, payload); err != nil {
+		return err
+	}
+	return jobs.Enqueue(ctx, e, JobTranscodeDrop, payload)
+}
+
+// EnqueueMoveMedia schedules moving a drop's media to the store matching its
+// visibility. Pass the transaction that changed the visibility.
+func EnqueueMoveMedia(ctx context.Context, e db.Execer, dropID uuid.UUID) error {
+	return jobs.Enqueue(ctx, e, JobMoveDropMedia, processDropPayload{DropID: dropID})
+}
+
+// dropVideo is a drop being processed with a local copy of its video
+type dropVideo struct {
+	DropID   uuid.UUID
+	VideoKey string
+	Duration float64
+	Path     string
+	Private  bool // media lives in storage.Private
+}
+
+// Store returns the store holding the drop's media
+func (v *dropVideo) Store() storage.ObjectStore {
+	return storage.For(v.Private)
+}
+
+// loadDropVideo decodes a drop job payload and downloads the drop's video.
+// It returns nil when the drop no longer exists; otherwise the caller
+// removes the downloaded file.
+func loadDropVideo(ctx context.Context, job *jobs.Job) (*dropVideo, error) {
+	var payload processDropPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+
+	v := &dropVideo{DropID: payload.DropID}
+	err := db.DB.QueryRow(ctx, `SELECT video_key, duration, media_private FROM drops WHERE id = $1`, payload.DropID).
+		Scan(&v.VideoKey, &v.Duration, &v.Private)
+	if err == pgx.ErrNoRows {
+		// Drop was deleted before it was processed
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v.Path, err = storage.DownloadToTemp(ctx, v.Store(), v.VideoKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, jobs.Permanent(fmt.Errorf("video %s is missing from storage", v.VideoKey))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download video: %w", err)
+	}
+	return v, nil
+}
+
+// processDrop picks thumbnail candidates and renders the animated preview,
+// then marks the drop ready. The best-scoring candidate becomes the thumbnail
+// unless the drop already has one.
+func processDrop(ctx context.Context, job *jobs.Job) error {
+	v, err := loadDropVideo(ctx, job)
+	if err != nil || v == nil {
+		return err
+	}
+	defer os.Remove(v.Path)
+
+	workDir, err := os.MkdirTemp("", "thumbs-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	candidates, err := media.GenerateCandidates(ctx, v.Path, workDir, v.Duration, thumbnailCandidates)
+	if err != nil {
+		return err
+	}
+
+	blurHash, dominantColor, err := media.Placeholder(candidates[0].Path)
+	if err != nil {
+		log.Printf("Failed to compute placeholder for drop %s: %v", v.DropID, err)
+	}
+
+	// Keys are derived from the drop, so a retry overwrites what an earlier
+	// attempt uploaded instead of orphaning it
+	store := v.Store()
+	keys := []string{}
+	urls := []string{}
+	for i, cand := range candidates {
+		key := fmt.Sprintf("thumbnails/%s-%d.jpg", v.DropID, i)
+		if err := putFile(ctx, store, key, cand.Path, "image/jpeg"); err != nil {
+			return fmt.Errorf("failed to upload thumbnail: %w", err)
+		}
+		keys = append(keys, key)
+		urls = append(urls, store.PublicURL(key))
+	}
+
+	// The preview is a nice-to-have; a drop without one is still usable
+	previewKey, previewURL := "", ""
+	previewPath := filepath.Join(workDir, "preview.mp4")
+	start, length := media.PreviewWindow(candidates[0].Timestamp, v.Duration, previewLength)
+	if err := media.GeneratePreview(ctx, v.Path, previewPath, start, length); err != nil {
+		log.Printf("Failed to generate preview for drop %s: %v", v.DropID, err)
+	} else if err := putFile(ctx, store, "previews/"+v.DropID.String()+".mp4", previewPath, "video/mp4"); err != nil {
+		log.Printf("Failed to upload preview for drop %s: %v", v.DropID, err)
+	} else {
+		previewKey = "previews/" + v.DropID.String() + ".mp4"
+		previewURL = store.PublicURL(previewKey)
+	}
+
+	// A thumbnail already set, by an earlier attempt or picked by the owner,
+	// is kept along with its placeholder
+	tag, err := db.DB.Exec(ctx, `
+		UPDATE drops
+		SET thumbnail = CASE WHEN thumbnail_key = '' THEN $2 ELSE thumbnail END,
+		    thumbnail_key = CASE WHEN thumbnail_key = '' THEN $3 ELSE thumbnail_key END,
+		    blurhash = CASE WHEN thumbnail_key = '' THEN $8 ELSE blurhash END,
+		    dominant_color = CASE WHEN thumbnail_key = '' THEN $9 ELSE dominant_color END,
+		    thumbnail_candidates = $4, thumbnail_candidate_keys = $5,
+		    preview_url = $6, preview_key = $7, status = $10, updated_at = NOW()
+		WHERE id = $1 AND media_private = $11
+	`, v.DropID, urls[0], keys[0], urls, keys, previewURL, previewKey, blurHash, dominantColor, models.DropStatusReady, v.Private)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		// Nothing in this store refers to the uploads any more
+		if previewKey != "" {
+			keys = append(keys, previewKey)
+		}
+		for _, key := range keys {
+			_ = store.Delete(context.Background(), key)
+		}
+		return retryIfMoved(ctx, v.DropID)
+	}
+	log.Printf("Processed drop %s", v.DropID)
+	return nil
+}
+
+// transcodeDrop builds the HLS ladder for a drop and stores it next to the
+// original video, under "<video key without extension>/hls/"
+func transcodeDrop(ctx context.Context, job *jobs.Job) error {
+	v, err := loadDropVideo(ctx, job)
+	if err != nil || v == nil {
+		return err
+	}
+	defer os.Remove(v.Path)
+
+	outDir, err := os.MkdirTemp("", "hls-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outDir)
+
+	if err := media.TranscodeHLS(ctx, v.Path, outDir, media.DefaultLadder); err != nil {
+		return err
+	}
+
+	store := v.Store()
+	prefix := HLSPrefix(v.VideoKey)
+	err = filepath.WalkDir(outDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(outDir, p)
+		if err != nil {
+			return err
+		}
+		return putFile(ctx, store, prefix+filepath.ToSlash(rel), p, media.ContentType(p))
+	})
+	if err != nil {
+		deletePrefix(store, prefix)
+		return fmt.Errorf("failed to upload HLS output: %w", err)
+	}
+
+	playlistKey := prefix + media.MasterPlaylistName
+	tag, err := db.DB.Exec(ctx, `
+		UPDATE drops SET playlist_url = $2, playlist_key = $3, updated_at = NOW() WHERE id = $1 AND media_private = $4
+	`, v.DropID, store.PublicURL(playlistKey), playlistKey, v.Private)
+	if err != nil {
+		deletePrefix(store, prefix)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		deletePrefix(store, prefix)
+		return retryIfMoved(ctx, v.DropID)
+	}
+	log.Printf("Transcoded drop %s", v.DropID)
+	return nil
+}
+
+// HLSPrefix returns the key prefix holding the HLS output for videoKey
+func HLSPrefix(videoKey string) string {
+	return strings.TrimSuffix(videoKey, path.Ext(videoKey)) + "/hls/"
+}
+
+// retryIfMoved is called when a job's drop update matched nothing. Either the
+// drop was deleted, or its media moved to the other store while the job ran,
+// in which case the job fails so its retry uses the new store.
+func retryIfMoved(ctx context.Context, dropID uuid.UUID) error {
+	var exists bool
+	if err := db.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM drops WHERE id = $1)`, dropID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("media of drop %s moved while it was processed", dropID)
+	}
+	return nil
+}
+
+// DeleteDropObjects removes every stored object belonging to drop, logging failures
+func DeleteDropObjects(ctx context.Context, drop *models.Drop) {
+	store := storage.For(drop.MediaPrivate)
+	keys := append([]string{drop.VideoKey, drop.ThumbnailKey, drop.PreviewKey}, drop.ThumbnailCandidateKeys...)
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := store.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+			log.Println("Failed to delete object", key, err)
+		}
+	}
+	if drop.VideoKey != "" {
+		deletePrefix(store, HLSPrefix(drop.VideoKey))
+	}
+}
+
+// deletePrefix removes every object under prefix, logging failures
+func deletePrefix(store storage.ObjectStore, prefix string) {
+	if err := storage.DeletePrefix(context.Background(), store, prefix); err != nil {
+		log.Println("Failed to delete objects under", prefix, err)
+	}
+}
+
+// failDrop marks a drop whose processing exhausted its retries
+func failDrop(ctx context.Context, job *jobs.Job, err error) {
+	var payload processDropPayload
+	if json.Unmarshal(job.Payload, &payload) != nil {
+		return
+	}
+	_, dbErr := db.DB.Exec(ctx, `UPDATE drops SET status = $2, updated_at = NOW() WHERE id = $1`,
+		payload.DropID, models.DropStatusFailed)
+	if dbErr != nil {
+		log.Printf("Failed to mark drop %s failed: %v", payload.DropID, dbErr)
+	}
+}
+
+// putFile uploads the file at path to key in store
+func putFile(ctx context.Context, store storage.ObjectStore, key, path, contentType string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size := int64(-1)
+	if fi, err := f.Stat(); err == nil {
+		size = fi.Size()
+	}
+	return store.Put(ctx, key, f, storage.PutOptions{ContentType: contentType, Size: size})
+}
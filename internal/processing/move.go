@@ -0,0 +1,129 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/jobs"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+)
+
+// moveDropMedia copies a drop's media to the store matching its visibility
+// (private unless public), then deletes the originals. The drop row stays
+// locked while copying, so processing jobs that finish meanwhile see the new
+// store and retry.
+func moveDropMedia(ctx context.Context, job *jobs.Job) error {
+	var payload processDropPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+
+	var from storage.ObjectStore
+	var moved []string
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		var d models.Drop
+		err := tx.QueryRow(ctx, `
+			SELECT visibility, media_private, video_key, thumbnail_key, thumbnail_candidate_keys, preview_key, playlist_key
+			FROM drops WHERE id = $1 FOR UPDATE
+		`, payload.DropID).Scan(&d.Visibility, &d.MediaPrivate, &d.VideoKey, &d.ThumbnailKey,
+			&d.ThumbnailCandidateKeys, &d.PreviewKey, &d.PlaylistKey)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		private := d.Visibility != models.DropVisibilityPublic
+		if private == d.MediaPrivate {
+			// Already in place, e.g. the visibility was changed back
+			return nil
+		}
+
+		from = storage.For(d.MediaPrivate)
+		to := storage.For(private)
+		keys, err := dropObjectKeys(ctx, from, &d)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			err := storage.Copy(ctx, from, to, key)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				for _, done := range moved {
+					_ = to.Delete(context.Background(), done)
+				}
+				return fmt.Errorf("failed to copy %s: %w", key, err)
+			}
+			moved = append(moved, key)
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE drops
+			SET media_private = $2, video_url = $3, thumbnail = $4, thumbnail_candidates = $5,
+			    preview_url = $6, playlist_url = $7, updated_at = NOW()
+			WHERE id = $1
+		`, payload.DropID, private, publicURL(to, d.VideoKey), publicURL(to, d.ThumbnailKey),
+			publicURLs(to, d.ThumbnailCandidateKeys), publicURL(to, d.PreviewKey), publicURL(to, d.PlaylistKey))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range moved {
+		if err := from.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+			log.Println("Failed to delete moved object", key, err)
+		}
+	}
+	if len(moved) > 0 {
+		log.Printf("Moved %d objects of drop %s", len(moved), payload.DropID)
+	}
+	return nil
+}
+
+// dropObjectKeys lists every object belonging to drop in store
+func dropObjectKeys(ctx context.Context, store storage.ObjectStore, drop *models.Drop) ([]string, error) {
+	// The thumbnail is usually one of the candidates
+	keys := []string{}
+	seen := map[string]bool{"": true}
+	for _, key := range append([]string{drop.VideoKey, drop.ThumbnailKey, drop.PreviewKey}, drop.ThumbnailCandidateKeys...) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	if drop.VideoKey == "" {
+		return keys, nil
+	}
+	hls, err := store.List(ctx, HLSPrefix(drop.VideoKey))
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range hls {
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+func publicURL(store storage.ObjectStore, key string) string {
+	if key == "" {
+		return ""
+	}
+	return store.PublicURL(key)
+}
+
+func publicURLs(store storage.ObjectStore, keys []string) []string {
+	urls := make([]string, len(keys))
+	for i, key := range keys {
+		urls[i] = store.PublicURL(key)
+	}
+	return urls
+}
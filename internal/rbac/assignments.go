@@ -0,0 +1,94 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+// Assignment is a role held by a user, globally or within a group
+type Assignment struct {
+	Role      Role       `json:"role"`
+	GroupID   *uuid.UUID `json:"group_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ListAssignments returns the roles assigned to a user
+func ListAssignments(ctx context.Context, userID string) ([]Assignment, error) {
+	rows, err := db.DB.Query(ctx, `
+		SELECT role, group_id, created_at FROM user_roles
+		WHERE user_id = $1 ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []Assignment{}
+	for rows.Next() {
+		var a Assignment
+		if err := rows.Scan(&a.Role, &a.GroupID, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+// Assign gives a user a role, globally when groupID is nil. Assigning an
+// existing role is a no-op.
+func Assign(ctx context.Context, userID string, role Role, groupID *uuid.UUID) error {
+	if !ValidRole(role) {
+		return ErrUnknownRole
+	}
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO user_roles (user_id, role, group_id, created_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT DO NOTHING
+		`, userID, role, groupID)
+		if err != nil {
+			return err
+		}
+		return syncAdminFlag(ctx, tx, userID, role, groupID)
+	})
+	// user_roles.user_id references users
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return ErrUnknownUser
+	}
+	return err
+}
+
+// Revoke removes a role from a user
+func Revoke(ctx context.Context, userID string, role Role, groupID *uuid.UUID) error {
+	return pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			DELETE FROM user_roles
+			WHERE user_id = $1 AND role = $2 AND group_id IS NOT DISTINCT FROM $3
+		`, userID, role, groupID)
+		if err != nil {
+			return err
+		}
+		return syncAdminFlag(ctx, tx, userID, role, groupID)
+	})
+}
+
+// syncAdminFlag keeps users.is_admin in line with global admin assignments,
+// since clients still read it
+func syncAdminFlag(ctx context.Context, tx pgx.Tx, userID string, role Role, groupID *uuid.UUID) error {
+	if role != RoleAdmin || groupID != nil {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE users SET is_admin = EXISTS (
+			SELECT 1 FROM user_roles WHERE user_id = $1 AND role = 'admin' AND group_id IS NULL
+		) WHERE id = $1
+	`, userID)
+	return err
+}
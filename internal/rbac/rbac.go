@@ -0,0 +1,154 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+// Permission is a named action, written resource:action[:scope]
+type Permission string
+
+const (
+	DropsReadAny   Permission = "drops:read:any"
+	DropsUpdateAny Permission = "drops:update:any"
+	DropsDeleteAny Permission = "drops:delete:any"
+	UsersManage    Permission = "users:manage"
+	RolesManage    Permission = "roles:manage"
+)
+
+// Role is a named bundle of permissions. A role can be assigned globally or
+// scoped to a group, in which case its permissions only apply to that
+// group's resources (e.g. a group moderator can delete any drop in the group).
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// ErrUnknownRole is returned for role names not in rolePermissions
+var ErrUnknownRole = errors.New("unknown role")
+
+// ErrUnknownUser is returned when assigning a role to a user that doesn't exist
+var ErrUnknownUser = errors.New("unknown user")
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:      {},
+	RoleModerator: {DropsReadAny, DropsUpdateAny, DropsDeleteAny},
+	RoleAdmin:     {DropsReadAny, DropsUpdateAny, DropsDeleteAny, UsersManage, RolesManage},
+}
+
+// ValidRole reports whether r is a known role
+func ValidRole(r Role) bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Grants is everything a user is allowed to do, globally and per group
+type Grants struct {
+	UserID string
+	global map[Permission]bool
+	groups map[uuid.UUID]map[Permission]bool
+}
+
+// Has reports whether the user holds p globally
+func (g *Grants) Has(p Permission) bool {
+	return g.global[p]
+}
+
+// HasIn reports whether the user holds p globally or within groupID
+func (g *Grants) HasIn(p Permission, groupID *uuid.UUID) bool {
+	if g.global[p] {
+		return true
+	}
+	return groupID != nil && g.groups[*groupID][p]
+}
+
+// GroupsWith returns the groups in which the user holds p through a group-scoped role
+func (g *Grants) GroupsWith(p Permission) []uuid.UUID {
+	groups := []uuid.UUID{}
+	for id, perms := range g.groups {
+		if perms[p] {
+			groups = append(groups, id)
+		}
+	}
+	return groups
+}
+
+// Load reads the user's role assignments. The legacy users.is_admin flag
+// counts as a global admin role.
+func Load(ctx context.Context, userID string) (*Grants, error) {
+	g := &Grants{UserID: userID, global: map[Permission]bool{}, groups: map[uuid.UUID]map[Permission]bool{}}
+
+	var isAdmin bool
+	err := db.DB.QueryRow(ctx, `SELECT COALESCE((SELECT is_admin FROM users WHERE id = $1), false)`, userID).Scan(&isAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if isAdmin {
+		g.add(RoleAdmin, nil)
+	}
+
+	rows, err := db.DB.Query(ctx, `SELECT role, group_id FROM user_roles WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role Role
+		var groupID *uuid.UUID
+		if err := rows.Scan(&role, &groupID); err != nil {
+			return nil, err
+		}
+		g.add(role, groupID)
+	}
+	return g, rows.Err()
+}
+
+func (g *Grants) add(role Role, groupID *uuid.UUID) {
+	target := g.global
+	if groupID != nil {
+		target = g.groups[*groupID]
+		if target == nil {
+			target = map[Permission]bool{}
+			g.groups[*groupID] = target
+		}
+	}
+	for _, p := range rolePermissions[role] {
+		target[p] = true
+	}
+}
+
+// grantsKey caches the caller's grants on the request
+const grantsKey = "rbacGrants"
+
+// ForRequest returns the grants of the authenticated caller, loading them once per request
+func ForRequest(c *gin.Context) (*Grants, error) {
+	if g, ok := c.Get(grantsKey); ok {
+		return g.(*Grants), nil
+	}
+	g, err := Load(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		return nil, err
+	}
+	c.Set(grantsKey, g)
+	return g, nil
+}
+
+// OwnerOr is the usual resource check: the caller owns the resource, or
+// holds perm globally or in the resource's group
+func OwnerOr(c *gin.Context, ownerID string, perm Permission, groupID *uuid.UUID) (bool, error) {
+	if ownerID != "" && ownerID == c.GetString("userId") {
+		return true, nil
+	}
+	g, err := ForRequest(c)
+	if err != nil {
+		return false, err
+	}
+	return g.HasIn(perm, groupID), nil
+}
@@ -0,0 +1,148 @@
+package rbac
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func newGrants(global []Role, groups map[uuid.UUID][]Role) *Grants {
+	g := &Grants{UserID: "user-1", global: map[Permission]bool{}, groups: map[uuid.UUID]map[Permission]bool{}}
+	for _, r := range global {
+		g.add(r, nil)
+	}
+	for id, roles := range groups {
+		for _, r := range roles {
+			g.add(r, &id)
+		}
+	}
+	return g
+}
+
+func TestGrants(t *testing.T) {
+	groupA, groupB := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name       string
+		grants     *Grants
+		group      *uuid.UUID
+		wantHas    bool
+		wantHasIn  bool
+		wantGroups []uuid.UUID
+	}{
+		{
+			name:       "plain user",
+			grants:     newGrants([]Role{RoleUser}, nil),
+			group:      &groupA,
+			wantGroups: []uuid.UUID{},
+		},
+		{
+			name:       "global moderator",
+			grants:     newGrants([]Role{RoleModerator}, nil),
+			group:      &groupA,
+			wantHas:    true,
+			wantHasIn:  true,
+			wantGroups: []uuid.UUID{},
+		},
+		{
+			name:       "global moderator, drop outside any group",
+			grants:     newGrants([]Role{RoleModerator}, nil),
+			wantHas:    true,
+			wantHasIn:  true,
+			wantGroups: []uuid.UUID{},
+		},
+		{
+			name:       "moderator of the drop's group",
+			grants:     newGrants(nil, map[uuid.UUID][]Role{groupA: {RoleModerator}}),
+			group:      &groupA,
+			wantHasIn:  true,
+			wantGroups: []uuid.UUID{groupA},
+		},
+		{
+			name:       "moderator of another group",
+			grants:     newGrants(nil, map[uuid.UUID][]Role{groupB: {RoleModerator}}),
+			group:      &groupA,
+			wantGroups: []uuid.UUID{groupB},
+		},
+		{
+			name:       "group moderator, drop outside any group",
+			grants:     newGrants(nil, map[uuid.UUID][]Role{groupA: {RoleModerator}}),
+			wantGroups: []uuid.UUID{groupA},
+		},
+		{
+			name:       "group roles without the permission",
+			grants:     newGrants(nil, map[uuid.UUID][]Role{groupA: {RoleUser}, groupB: {RoleAdmin}}),
+			group:      &groupA,
+			wantGroups: []uuid.UUID{groupB},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.grants.Has(DropsReadAny); got != tt.wantHas {
+				t.Errorf("Has = %v, want %v", got, tt.wantHas)
+			}
+			if got := tt.grants.HasIn(DropsReadAny, tt.group); got != tt.wantHasIn {
+				t.Errorf("HasIn = %v, want %v", got, tt.wantHasIn)
+			}
+			if got := tt.grants.GroupsWith(DropsReadAny); !slices.Equal(got, tt.wantGroups) {
+				t.Errorf("GroupsWith = %v, want %v", got, tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	admin := newGrants([]Role{RoleAdmin}, nil)
+	moderator := newGrants([]Role{RoleModerator}, nil)
+	for _, p := range []Permission{UsersManage, RolesManage} {
+		if !admin.Has(p) || moderator.Has(p) {
+			t.Errorf("%s: admin %v, moderator %v", p, admin.Has(p), moderator.Has(p))
+		}
+	}
+	if newGrants([]Role{"superuser"}, nil).Has(DropsReadAny) {
+		t.Error("an unknown role granted a permission")
+	}
+	if ValidRole("superuser") || !ValidRole(RoleModerator) {
+		t.Error("ValidRole")
+	}
+}
+
+func TestOwnerOr(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	groupA, groupB := uuid.New(), uuid.New()
+	moderatorOfA := newGrants(nil, map[uuid.UUID][]Role{groupA: {RoleModerator}})
+
+	tests := []struct {
+		name  string
+		owner string
+		group *uuid.UUID
+		want  bool
+	}{
+		{"owner", "caller", nil, true},
+		{"someone else's drop in the moderated group", "other", &groupA, true},
+		{"someone else's drop in another group", "other", &groupB, false},
+		{"someone else's drop outside groups", "other", nil, false},
+		{"empty owner never matches", "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/", nil)
+			c.Set("userId", "caller")
+			if tt.owner == "" {
+				c.Set("userId", "")
+			}
+			c.Set(grantsKey, moderatorOfA)
+			got, err := OwnerOr(c, tt.owner, DropsDeleteAny, tt.group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("OwnerOr = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
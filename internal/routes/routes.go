@@ -4,24 +4,99 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/richiethie/BitDrop.Server/internal/handlers"
 	"github.com/richiethie/BitDrop.Server/internal/middleware"
+	"github.com/richiethie/BitDrop.Server/internal/rbac"
+	"github.com/richiethie/BitDrop.Server/internal/services"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
 )
 
 func RegisterRoutes(r *gin.Engine) {
+	// Object routes for storage backends that serve files themselves
+	storage.RegisterRoutes(r)
+
+	// Public keys for services that verify our access tokens
+	r.GET("/.well-known/jwks.json", handlers.JWKSHandler)
+
 	api := r.Group("/api")
 
 	// Public routes
 	api.POST("/signup", handlers.SignUp)
 	api.POST("/login", handlers.Login)
+	api.POST("/login/2fa", handlers.LoginTOTP)
 	api.POST("/logout", handlers.Logout)
+	api.POST("/token/refresh", handlers.RefreshToken)
+	api.POST("/auth/oidc/:provider/start", handlers.OIDCStartHandler)
+	api.POST("/auth/oidc/:provider/callback", handlers.OIDCCallbackHandler)
+	api.POST("/password/forgot", handlers.ForgotPasswordHandler)
+	api.POST("/password/reset", handlers.ResetPasswordHandler)
+	api.POST("/email/verify", handlers.VerifyEmailHandler)
 	api.GET("/check-availability", handlers.CheckAvailability)
+	api.GET("/account/exports/:id/download", handlers.DownloadExportHandler)
+	api.GET("/media/drops/:id/hls/*file", handlers.HLSProxyHandler)
+	api.OPTIONS("/uploads", handlers.TusOptionsHandler)
 
-	// Protected routes
+	// Protected routes (user access tokens only)
 	protected := api.Group("/")
 	protected.Use(middleware.AuthMiddleware())
 
-	protected.GET("/profile", handlers.GetProfile)
-	protected.POST("/drops/upload", handlers.UploadDropHandler)
-    protected.GET("/drops/user", handlers.GetUserDropsHandler)
-	protected.GET("/drops/:id/details", handlers.GetDropDetailsHandler)
-    protected.DELETE("/drops/:id", handlers.DeleteDropHandler)
+	protected.POST("/email/verify/resend", handlers.ResendVerificationHandler)
+	protected.POST("/onboarding/username", handlers.CompleteOnboardingHandler)
+	protected.PATCH("/profile", handlers.UpdateProfileHandler)
+	protected.GET("/profile/username-history", handlers.GetUsernameHistoryHandler)
+	protected.PUT("/profile/avatar", handlers.UploadAvatarHandler)
+	protected.DELETE("/profile/avatar", handlers.DeleteAvatarHandler)
+	protected.DELETE("/account", handlers.DeleteAccountHandler)
+	protected.POST("/account/restore", handlers.RestoreAccountHandler)
+	protected.POST("/account/export", handlers.RequestExportHandler)
+	protected.GET("/account/exports/:id", handlers.GetExportHandler)
+	protected.GET("/sessions", handlers.ListSessionsHandler)
+	protected.DELETE("/sessions", handlers.RevokeOtherSessionsHandler)
+	protected.DELETE("/sessions/:id", handlers.RevokeSessionHandler)
+	protected.POST("/auth/oidc/:provider/link", handlers.OIDCLinkHandler)
+	protected.GET("/identities", handlers.ListIdentitiesHandler)
+	protected.DELETE("/identities/:id", handlers.UnlinkIdentityHandler)
+	protected.GET("/2fa/totp", handlers.GetTOTPStatusHandler)
+	protected.POST("/2fa/totp/enroll", handlers.EnrollTOTPHandler)
+	protected.POST("/2fa/totp/enable", handlers.EnableTOTPHandler)
+	protected.POST("/2fa/totp/disable", handlers.DisableTOTPHandler)
+	protected.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodesHandler)
+	protected.GET("/api-keys", handlers.ListAPIKeysHandler)
+	protected.POST("/api-keys", handlers.CreateAPIKeyHandler)
+	protected.DELETE("/api-keys/:id", handlers.RevokeAPIKeyHandler)
+
+	// Role management
+	admin := protected.Group("/admin")
+	admin.Use(middleware.RequirePermission(rbac.RolesManage))
+	admin.GET("/users/:id/roles", handlers.ListUserRolesHandler)
+	admin.POST("/users/:id/roles", handlers.AssignUserRoleHandler)
+	admin.DELETE("/users/:id/roles/:role", handlers.RevokeUserRoleHandler)
+
+	// Routes that also accept API keys, each with the scope a key needs
+	integrations := api.Group("/")
+	integrations.Use(middleware.APIKeyAuthMiddleware())
+
+	readProfile := middleware.RequireScope(services.ScopeProfileRead)
+	readDrops := middleware.RequireScope(services.ScopeDropsRead)
+	writeDrops := middleware.RequireScope(services.ScopeDropsWrite)
+
+	integrations.GET("/profile", readProfile, handlers.GetProfile)
+	integrations.GET("/users/:username", readProfile, handlers.GetPublicProfileHandler)
+	integrations.GET("/users/:username/drops", readDrops, handlers.GetPublicUserDropsHandler)
+	integrations.POST("/drops/upload", writeDrops, middleware.RequireVerifiedEmail(), handlers.UploadDropHandler)
+	integrations.GET("/drops/upload/:uploadId/progress", readDrops, handlers.GetUploadProgressHandler)
+	integrations.POST("/drops/upload-url", writeDrops, middleware.RequireVerifiedEmail(), handlers.CreateUploadURLHandler)
+	integrations.POST("/drops/:id/finalize", writeDrops, handlers.FinalizeDropHandler)
+	integrations.GET("/drops/user", readDrops, handlers.GetUserDropsHandler)
+	integrations.GET("/drops/:id/details", readDrops, handlers.GetDropDetailsHandler)
+	integrations.DELETE("/drops/:id", writeDrops, handlers.DeleteDropHandler)
+	integrations.PUT("/drops/:id/thumbnail", writeDrops, handlers.SelectThumbnailHandler)
+	integrations.PUT("/drops/:id/visibility", writeDrops, handlers.UpdateDropVisibilityHandler)
+	integrations.GET("/drops/:id/shares", readDrops, handlers.ListDropSharesHandler)
+	integrations.POST("/drops/:id/shares", writeDrops, handlers.AddDropSharesHandler)
+	integrations.DELETE("/drops/:id/shares/:userId", writeDrops, handlers.RemoveDropShareHandler)
+
+	// Resumable (tus) uploads
+	integrations.POST("/uploads", writeDrops, middleware.RequireVerifiedEmail(), handlers.TusCreateHandler)
+	integrations.HEAD("/uploads/:id", writeDrops, handlers.TusHeadHandler)
+	integrations.PATCH("/uploads/:id", writeDrops, handlers.TusPatchHandler)
+	integrations.DELETE("/uploads/:id", writeDrops, handlers.TusDeleteHandler)
 }
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/mailer"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// appLink builds a link into the client app (APP_URL) carrying token
+func appLink(path, token string) string {
+	base := strings.TrimRight(os.Getenv("APP_URL"), "/")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return base + path + "?token=" + url.QueryEscape(token)
+}
+
+// SendVerificationEmail emails the user a link to confirm their address
+func SendVerificationEmail(ctx context.Context, userID, email string) error {
+	ttl := EmailVerificationTTL()
+	token, err := CreateUserToken(ctx, userID, TokenPurposeEmailVerification, ttl)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your BitDrop email",
+		Body: fmt.Sprintf("Welcome to BitDrop!\n\nConfirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			appLink("/verify-email", token), ttl),
+	})
+}
+
+// SendPasswordResetEmail emails the user a link to choose a new password
+func SendPasswordResetEmail(ctx context.Context, userID, email string) error {
+	ttl := PasswordResetTTL()
+	token, err := CreateUserToken(ctx, userID, TokenPurposePasswordReset, ttl)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your BitDrop password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your BitDrop account.\n\nOpen the link below to choose a new one:\n\n%s\n\nThe link expires in %s. If this wasn't you, you can ignore this email.\n",
+			appLink("/reset-password", token), ttl),
+	})
+}
+
+// VerifyEmail consumes a verification token and marks the user's email verified
+func VerifyEmail(ctx context.Context, token string) error {
+	return pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		userID, err := ConsumeUserToken(ctx, tx, token, TokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE users SET email_verified = true WHERE id = $1`, userID)
+		return err
+	})
+}
+
+// ResetPassword consumes a reset token, sets the new password and logs the
+// user out everywhere
+func ResetPassword(ctx context.Context, token, password string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	var userID string
+	err = pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		userID, err = ConsumeUserToken(ctx, tx, token, TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+		// Following the emailed link proves the user owns the address
+		_, err = tx.Exec(ctx, `UPDATE users SET password = $2, email_verified = true WHERE id = $1`, userID, string(hashed))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = RevokeOtherSessions(ctx, userID, "")
+	return err
+}
+
+// ErrWrongPassword is returned when a password confirmation doesn't match
+var ErrWrongPassword = errors.New("incorrect password")
+
+// CheckPassword confirms password for sensitive actions. Accounts that only
+// sign in through a provider have no password and always pass.
+func CheckPassword(ctx context.Context, userID, password string) error {
+	var hashed *string
+	err := db.DB.QueryRow(ctx, `SELECT password FROM users WHERE id = $1`, userID).Scan(&hashed)
+	if err != nil {
+		return err
+	}
+	if hashed == nil || *hashed == "" {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(*hashed), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
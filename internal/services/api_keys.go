@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+)
+
+// APIKeyPrefix starts every API key so they're easy to recognize, including by secret scanners
+const APIKeyPrefix = "bd_"
+
+// API key scopes
+const (
+	ScopeProfileRead = "profile:read"
+	ScopeDropsRead   = "drops:read"
+	ScopeDropsWrite  = "drops:write"
+)
+
+var apiKeyScopes = map[string]bool{ScopeProfileRead: true, ScopeDropsRead: true, ScopeDropsWrite: true}
+
+const maxAPIKeysPerUser = 25
+
+var (
+	// ErrInvalidAPIKey is returned for unknown, expired or revoked keys
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIKeyNotFound is returned when revoking a key the user doesn't have
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrInvalidScope is returned when creating a key with an unknown scope
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrTooManyAPIKeys is returned when the user already has maxAPIKeysPerUser keys
+	ErrTooManyAPIKeys = errors.New("too many API keys")
+)
+
+// IsAPIKey reports whether a bearer credential looks like an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// CreateAPIKey issues a new key for userID. The raw key is only returned here.
+func CreateAPIKey(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	for _, s := range scopes {
+		if !apiKeyScopes[s] {
+			return "", nil, ErrInvalidScope
+		}
+	}
+
+	var count int
+	err := db.DB.QueryRow(ctx, `SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return "", nil, err
+	}
+	if count >= maxAPIKeysPerUser {
+		return "", nil, ErrTooManyAPIKeys
+	}
+
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	prefix := APIKeyPrefix + strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	secret, err := NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := prefix + "_" + secret
+
+	key := &models.APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	_, err = db.DB.Exec(ctx, `
+		INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, key.ID, userID, name, prefix, HashToken(raw), scopes, key.CreatedAt, expiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	return raw, key, nil
+}
+
+// ListAPIKeys returns the user's active keys
+func ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	rows, err := db.DB.Query(ctx, `
+		SELECT id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at, last_used_ip
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var k models.APIKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.LastUsedIP); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes one of the user's keys
+func RevokeAPIKey(ctx context.Context, userID string, id uuid.UUID) error {
+	tag, err := db.DB.Exec(ctx, `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey looks up a raw key and records that it was used from ip
+func AuthenticateAPIKey(ctx context.Context, raw, ip string) (*models.APIKey, error) {
+	var k models.APIKey
+	err := db.DB.QueryRow(ctx, `
+		SELECT id, user_id, name, prefix, scopes, created_at, expires_at
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`, HashToken(raw)).Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Busy scripts would otherwise write on every request
+	_, err = db.DB.Exec(ctx, `
+		UPDATE api_keys SET last_used_at = NOW(), last_used_ip = $2
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute' OR last_used_ip <> $2)
+	`, k.ID, ip)
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+func TestIsAPIKey(t *testing.T) {
+	tests := []struct {
+		credential string
+		want       bool
+	}{
+		{"bd_abcdefgh_secret", true},
+		{"eyJhbGciOiJFZERTQSJ9.e30.sig", false},
+		{"BD_abcdefgh_secret", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsAPIKey(tt.credential); got != tt.want {
+			t.Errorf("IsAPIKey(%q) = %v, want %v", tt.credential, got, tt.want)
+		}
+	}
+}
+
+func TestCreateAPIKeyRejectsUnknownScopes(t *testing.T) {
+	for _, scopes := range [][]string{{"admin"}, {ScopeDropsRead, "drops:delete"}, {""}} {
+		// Scopes are checked before anything touches the database
+		if _, _, err := CreateAPIKey(context.Background(), "user", "key", scopes, nil); !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("scopes %q: err = %v, want ErrInvalidScope", scopes, err)
+		}
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	useUsersDB(t, migration(t, "0016_api_keys.sql"))
+	ctx := context.Background()
+	userID := insertTestUser(t, "scripts@example.com", true)
+
+	raw, key, err := CreateAPIKey(ctx, userID, "backup script", []string{ScopeDropsRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAPIKey(raw) || !strings.HasPrefix(raw, key.Prefix+"_") {
+		t.Errorf("raw key %q doesn't start with its prefix %q", raw, key.Prefix)
+	}
+
+	got, err := AuthenticateAPIKey(ctx, raw, "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != userID || len(got.Scopes) != 1 || got.Scopes[0] != ScopeDropsRead {
+		t.Errorf("key = %+v", got)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	expired, _, err := CreateAPIKey(ctx, userID, "expired", []string{ScopeDropsRead}, &past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedKey, err := CreateAPIKey(ctx, userID, "revoked", []string{ScopeDropsWrite}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.Exec(ctx, `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1`, revokedKey.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, credential := range map[string]string{
+		"expired":          expired,
+		"revoked":          revoked,
+		"wrong secret":     key.Prefix + "_not-the-secret",
+		"prefix only":      key.Prefix,
+		"made up":          "bd_aaaaaaaa_bbbbbbbb",
+		"extra characters": raw + "x",
+	} {
+		if _, err := AuthenticateAPIKey(ctx, credential, "203.0.113.7"); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("%s: err = %v, want ErrInvalidAPIKey", name, err)
+		}
+	}
+}
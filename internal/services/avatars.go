@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/media"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+)
+
+// AvatarSizes are the square sizes, in pixels, every avatar is stored at.
+// avatar_url points at the largest.
+var AvatarSizes = []int{64, 128, 256, 512}
+
+// AvatarPrefix is the storage prefix holding a user's avatar images
+func AvatarPrefix(userID string) string {
+	return "avatars/" + userID + "/"
+}
+
+// UploadAvatar validates an uploaded image, stores it at every AvatarSizes
+// size and makes it the user's avatar, deleting the previous one. It returns
+// the new image URLs keyed by size.
+func UploadAvatar(ctx context.Context, userID string, data []byte) (map[string]string, error) {
+	img, err := media.DecodeAvatar(data, AvatarSizes[len(AvatarSizes)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	// A new name per upload, so caches never serve the old picture
+	version := uuid.NewString()
+	keys := []string{}
+	urls := map[string]string{}
+	cleanup := func() {
+		for _, key := range keys {
+			_ = storage.Default.Delete(context.Background(), key)
+		}
+	}
+	for _, size := range AvatarSizes {
+		var buf bytes.Buffer
+		if err := media.EncodeAvatar(&buf, media.SquareAvatar(img, size)); err != nil {
+			cleanup()
+			return nil, err
+		}
+		key := fmt.Sprintf("%s%s_%d.jpg", AvatarPrefix(userID), version, size)
+		err := storage.Default.Put(ctx, key, &buf, storage.PutOptions{ContentType: "image/jpeg", Size: int64(buf.Len())})
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to upload avatar: %w", err)
+		}
+		keys = append(keys, key)
+		urls[strconv.Itoa(size)] = storage.Default.PublicURL(key)
+	}
+
+	largest := urls[strconv.Itoa(AvatarSizes[len(AvatarSizes)-1])]
+	if err := replaceAvatar(ctx, userID, largest, keys); err != nil {
+		cleanup()
+		return nil, err
+	}
+	return urls, nil
+}
+
+// RemoveAvatar clears the user's avatar and deletes its images
+func RemoveAvatar(ctx context.Context, userID string) error {
+	return replaceAvatar(ctx, userID, "", []string{})
+}
+
+// replaceAvatar points the user at a new avatar, then deletes the images of
+// the one it replaced
+func replaceAvatar(ctx context.Context, userID, avatarURL string, keys []string) error {
+	var oldKeys []string
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `SELECT avatar_keys FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&oldKeys)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE users SET avatar_url = $2, avatar_keys = $3 WHERE id = $1`, userID, avatarURL, keys)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range oldKeys {
+		if err := storage.Default.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+			log.Println("Failed to delete old avatar", key, err)
+		}
+	}
+	return nil
+}
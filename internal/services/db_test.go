@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+// testUsersTable is the part of the users table the services read. The base
+// schema predates the migrations, so tests create it themselves; useUsersDB
+// adds the indexes later migrations put on it.
+const testUsersTable = `
+	CREATE TABLE users (
+		id UUID PRIMARY KEY,
+		email TEXT NOT NULL UNIQUE,
+		username TEXT NOT NULL,
+		password TEXT,
+		display_name TEXT NOT NULL DEFAULT '',
+		avatar_url TEXT NOT NULL DEFAULT '',
+		bio TEXT NOT NULL DEFAULT '',
+		tier TEXT NOT NULL DEFAULT 'free',
+		boosts_left INT NOT NULL DEFAULT 0,
+		is_admin BOOLEAN NOT NULL DEFAULT false,
+		email_verified BOOLEAN NOT NULL DEFAULT false,
+		needs_onboarding BOOLEAN NOT NULL DEFAULT false,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_active TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		deletion_scheduled_at TIMESTAMPTZ
+	)`
+
+// useTestDB points db.DB at a fresh schema in TEST_DATABASE_URL and runs the
+// given statements there. The test is skipped when no database is configured.
+func useTestDB(t *testing.T, schema ...string) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	name := fmt.Sprintf("bitdrop_test_%d", time.Now().UnixNano())
+
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	config.ConnConfig.RuntimeParams["search_path"] = name
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, `CREATE SCHEMA `+name); err != nil {
+		pool.Close()
+		t.Fatal(err)
+	}
+
+	prev := db.DB
+	db.DB = pool
+	t.Cleanup(func() {
+		db.DB = prev
+		_, _ = pool.Exec(context.Background(), `DROP SCHEMA `+name+` CASCADE`)
+		pool.Close()
+	})
+
+	for _, stmt := range schema {
+		if _, err := pool.Exec(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// useUsersDB is useTestDB with the users table as production has it,
+// followed by schema
+func useUsersDB(t *testing.T, schema ...string) {
+	t.Helper()
+	useTestDB(t, append([]string{testUsersTable, migration(t, "0022_unique_usernames.sql")}, schema...)...)
+}
+
+// migration returns the SQL of a file in migrations/
+func migration(t *testing.T, name string) string {
+	t.Helper()
+	sql, err := os.ReadFile("../../migrations/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(sql)
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+	"github.com/richiethie/BitDrop.Server/internal/utils"
+)
+
+// MediaURLTTL is how long the signed media URLs of non-public drops stay
+// valid (MEDIA_URL_TTL, default 1 hour). Clients re-fetch the drop for fresh ones.
+func MediaURLTTL() time.Duration {
+	return envDuration("MEDIA_URL_TTL", time.Hour)
+}
+
+// mediaURLKey authenticates the HLS proxy URLs of private drops
+var mediaURLKey []byte
+
+// InitMediaURLs reads MEDIA_URL_SECRET, the key for signed HLS URLs. Without
+// it a random key is used, so URLs don't survive a restart and aren't valid
+// across API instances.
+func InitMediaURLs() error {
+	if secret := os.Getenv("MEDIA_URL_SECRET"); secret != "" {
+		mediaURLKey = []byte(secret)
+		return nil
+	}
+	log.Println("⚠️ MEDIA_URL_SECRET not set, using a temporary key for media URLs")
+	mediaURLKey = make([]byte, 32)
+	_, err := rand.Read(mediaURLKey)
+	return err
+}
+
+// SignDropMedia replaces the media URLs of drops whose media is private with
+// signed URLs that expire after MediaURLTTL. HLS playlists point at the API's
+// media proxy, since their relative segment URLs can't carry a storage
+// signature. Public drops are left alone.
+func SignDropMedia(ctx context.Context, drops ...*models.Drop) error {
+	ttl := MediaURLTTL()
+	expiresAt := time.Now().Add(ttl)
+
+	var keys []string
+	var dests []*string
+	sign := func(dst *string, key string) {
+		*dst = ""
+		if key != "" {
+			keys = append(keys, key)
+			dests = append(dests, dst)
+		}
+	}
+	for _, d := range drops {
+		if !d.MediaPrivate {
+			continue
+		}
+		sign(&d.VideoURL, d.VideoKey)
+		sign(&d.Thumbnail, d.ThumbnailKey)
+		sign(&d.PreviewURL, d.PreviewKey)
+		d.ThumbnailCandidates = make([]string, len(d.ThumbnailCandidateKeys))
+		for i, key := range d.ThumbnailCandidateKeys {
+			sign(&d.ThumbnailCandidates[i], key)
+		}
+		d.PlaylistURL = ""
+		if d.PlaylistKey != "" {
+			d.PlaylistURL = hlsURL(d.ID, path.Base(d.PlaylistKey), expiresAt)
+		}
+		d.MediaExpiresAt = &expiresAt
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	signer, ok := storage.Private.(storage.URLSigner)
+	if !ok {
+		return errors.New("private storage cannot sign URLs")
+	}
+	urls, err := signer.SignURLs(ctx, keys, ttl)
+	if err != nil {
+		return err
+	}
+	for i, u := range urls {
+		*dests[i] = u
+	}
+	return nil
+}
+
+// hlsURL returns the media proxy URL of file in a private drop's HLS output
+func hlsURL(dropID uuid.UUID, file string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	q := url.Values{"expires": {expires}, "signature": {signHLS(dropID, expires)}}
+	return utils.APIURL("/api/media/drops/"+dropID.String()+"/hls/"+file) + "?" + q.Encode()
+}
+
+// signHLS authorizes every file of a drop's HLS output until expires, so one
+// playlist URL covers the playlists and segments it references
+func signHLS(dropID uuid.UUID, expires string) string {
+	mac := hmac.New(sha256.New, mediaURLKey)
+	mac.Write([]byte("hls\n" + dropID.String() + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyHLSSignature checks the expires and signature query parameters of a
+// media proxy request for dropID
+func VerifyHLSSignature(dropID uuid.UUID, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signHLS(dropID, expires)), []byte(signature))
+}
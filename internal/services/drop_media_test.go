@@ -0,0 +1,82 @@
+package services
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func useMediaURLKey(t *testing.T, key string) {
+	t.Helper()
+	prev := mediaURLKey
+	mediaURLKey = []byte(key)
+	t.Cleanup(func() { mediaURLKey = prev })
+}
+
+func TestVerifyHLSSignature(t *testing.T) {
+	useMediaURLKey(t, "test-media-key")
+	dropID, otherDrop := uuid.New(), uuid.New()
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	later := strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)
+	past := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	valid := signHLS(dropID, future)
+
+	tests := []struct {
+		name      string
+		drop      uuid.UUID
+		expires   string
+		signature string
+		want      bool
+	}{
+		{"valid", dropID, future, valid, true},
+		{"expired", dropID, past, signHLS(dropID, past), false},
+		{"another drop", otherDrop, future, valid, false},
+		{"extended expiry", dropID, later, valid, false},
+		{"tampered signature", dropID, future, strings.Repeat("0", len(valid)), false},
+		{"uppercase signature", dropID, future, strings.ToUpper(valid), false},
+		{"missing signature", dropID, future, "", false},
+		{"non-numeric expiry", dropID, "never", signHLS(dropID, "never"), false},
+		{"missing expiry", dropID, "", signHLS(dropID, ""), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyHLSSignature(tt.drop, tt.expires, tt.signature); got != tt.want {
+				t.Errorf("VerifyHLSSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHLSSignatureDependsOnKey(t *testing.T) {
+	dropID := uuid.New()
+	expires := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	useMediaURLKey(t, "old-key")
+	signature := signHLS(dropID, expires)
+
+	mediaURLKey = []byte("new-key")
+	if VerifyHLSSignature(dropID, expires, signature) {
+		t.Error("a signature from another key was accepted")
+	}
+}
+
+func TestHLSURL(t *testing.T) {
+	useMediaURLKey(t, "test-media-key")
+	dropID := uuid.New()
+	raw := hlsURL(dropID, "master.m3u8", time.Now().Add(time.Hour))
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/api/media/drops/" + dropID.String() + "/hls/master.m3u8"; !strings.HasSuffix(u.Path, want) {
+		t.Errorf("path = %s, want suffix %s", u.Path, want)
+	}
+	q := u.Query()
+	if !VerifyHLSSignature(dropID, q.Get("expires"), q.Get("signature")) {
+		t.Errorf("URL %s doesn't verify", raw)
+	}
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+	"github.com/richiethie/BitDrop.Server/internal/oidc"
+)
+
+// oidcStateTTL is how long the user has to finish signing in at the provider
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	// ErrInvalidOIDCState is returned for unknown, expired or reused login states
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	// ErrIdentityLinkedElsewhere is returned when linking a provider account
+	// that already belongs to another user
+	ErrIdentityLinkedElsewhere = errors.New("identity is linked to another account")
+	// ErrAccountExists is returned when a new provider login matches an existing
+	// account we can't safely link automatically
+	ErrAccountExists = errors.New("an account with this email already exists")
+	// ErrEmailRequired is returned when a provider doesn't share an email for a new account
+	ErrEmailRequired = errors.New("identity provider did not share an email address")
+	// ErrEmailNotVerified is returned when a new account would be created from
+	// an email the provider hasn't verified
+	ErrEmailNotVerified = errors.New("identity provider has not verified the email address")
+	// ErrIdentityNotFound is returned when unlinking an identity the user doesn't have
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrLastLoginMethod is returned when unlinking would leave no way to log in
+	ErrLastLoginMethod = errors.New("cannot remove the last login method")
+)
+
+// OIDCStart is what the client needs to send the user to the provider
+type OIDCStart struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+// OIDCResult is the outcome of a completed provider login
+type OIDCResult struct {
+	UserID     string
+	DeviceName string
+	// Linked is set when the flow linked an identity to a logged-in user
+	// rather than logging someone in
+	Linked bool
+}
+
+// StartOIDC begins an authorization code flow with provider. linkUserID is
+// set when a logged-in user is linking a new provider to their account.
+func StartOIDC(ctx context.Context, provider, deviceName, linkUserID string) (*OIDCStart, error) {
+	p, err := oidc.Get(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := oidc.RandomString(48)
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	// Abandoned flows are cleaned up whenever a new one starts
+	if _, err := db.DB.Exec(ctx, `DELETE FROM oidc_states WHERE expires_at < NOW()`); err != nil {
+		return nil, err
+	}
+
+	var linkUser *string
+	if linkUserID != "" {
+		linkUser = &linkUserID
+	}
+	_, err = db.DB.Exec(ctx, `
+		INSERT INTO oidc_states (id, state_hash, provider, code_verifier, nonce, device_name, link_user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), $8)
+	`, uuid.New(), HashToken(state), p.Name, verifier, nonce, deviceName, linkUser, time.Now().Add(oidcStateTTL))
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCStart{AuthorizationURL: authURL, State: state}, nil
+}
+
+// FinishOIDC completes a flow started by StartOIDC: it exchanges the code,
+// verifies the ID token and finds, links or creates the BitDrop user
+func FinishOIDC(ctx context.Context, provider, code, state string) (*OIDCResult, error) {
+	p, err := oidc.Get(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	var verifier, nonce, deviceName string
+	var linkUserID *string
+	var expiresAt time.Time
+	err = db.DB.QueryRow(ctx, `
+		DELETE FROM oidc_states WHERE state_hash = $1 AND provider = $2
+		RETURNING code_verifier, nonce, device_name, link_user_id::text, expires_at
+	`, HashToken(state), p.Name).Scan(&verifier, &nonce, &deviceName, &linkUserID, &expiresAt)
+	if err == pgx.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := p.VerifyIDToken(ctx, idToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	claims.Email = strings.ToLower(strings.TrimSpace(claims.Email))
+
+	result := &OIDCResult{DeviceName: deviceName}
+
+	var existingUserID string
+	err = db.DB.QueryRow(ctx, `
+		SELECT user_id FROM identities WHERE provider = $1 AND subject = $2
+	`, p.Name, claims.Subject).Scan(&existingUserID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+
+	switch {
+	case linkUserID != nil:
+		if existingUserID != "" && existingUserID != *linkUserID {
+			return nil, ErrIdentityLinkedElsewhere
+		}
+		result.UserID = *linkUserID
+		result.Linked = true
+	case existingUserID != "":
+		result.UserID = existingUserID
+	default:
+		result.UserID, err = userForNewIdentity(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = db.DB.Exec(ctx, `
+		INSERT INTO identities (id, user_id, provider, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		ON CONFLICT (provider, subject) DO UPDATE SET email = EXCLUDED.email, last_login_at = NOW()
+	`, uuid.New(), result.UserID, p.Name, claims.Subject, claims.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.EmailVerified && claims.Email != "" {
+		_, err = db.DB.Exec(ctx, `
+			UPDATE users SET email_verified = true WHERE id = $1 AND email = $2 AND NOT email_verified
+		`, result.UserID, claims.Email)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// userForNewIdentity picks the user a first-time provider login belongs to.
+// An existing account is only linked when both sides have verified the email,
+// so nobody can pre-register someone else's address and wait for them. For
+// the same reason a new account needs an email the provider verified.
+func userForNewIdentity(ctx context.Context, claims *oidc.Claims) (string, error) {
+	if claims.Email == "" {
+		return "", ErrEmailRequired
+	}
+
+	var userID string
+	var verified bool
+	err := db.DB.QueryRow(ctx, `
+		SELECT id, email_verified FROM users WHERE email = $1
+	`, claims.Email).Scan(&userID, &verified)
+	if err == nil {
+		if verified && claims.EmailVerified {
+			return userID, nil
+		}
+		return "", ErrAccountExists
+	}
+	if err != pgx.ErrNoRows {
+		return "", err
+	}
+	if !claims.EmailVerified {
+		return "", ErrEmailNotVerified
+	}
+
+	user, err := GetOrCreateUser(uuid.NewString(), claims.Email)
+	if err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
+
+// ListIdentities returns the user's linked providers and whether they also have a password
+func ListIdentities(ctx context.Context, userID string) ([]models.Identity, bool, error) {
+	var hasPassword bool
+	err := db.DB.QueryRow(ctx, `
+		SELECT COALESCE(password, '') <> '' FROM users WHERE id = $1
+	`, userID).Scan(&hasPassword)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rows, err := db.DB.Query(ctx, `
+		SELECT id, provider, email, created_at, last_login_at
+		FROM identities WHERE user_id = $1 ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	identities := []models.Identity{}
+	for rows.Next() {
+		var i models.Identity
+		if err := rows.Scan(&i.ID, &i.Provider, &i.Email, &i.CreatedAt, &i.LastLoginAt); err != nil {
+			return nil, false, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, hasPassword, rows.Err()
+}
+
+// UnlinkIdentity removes a linked provider, as long as the user can still log in some other way
+func UnlinkIdentity(ctx context.Context, userID string, identityID uuid.UUID) error {
+	return pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		var hasPassword bool
+		var others int
+		err := tx.QueryRow(ctx, `
+			SELECT COALESCE(password, '') <> '',
+			       (SELECT COUNT(*) FROM identities WHERE user_id = $1 AND id <> $2)
+			FROM users WHERE id = $1
+			FOR UPDATE
+		`, userID, identityID).Scan(&hasPassword, &others)
+		if err != nil {
+			return err
+		}
+		if !hasPassword && others == 0 {
+			return ErrLastLoginMethod
+		}
+
+		tag, err := tx.Exec(ctx, `DELETE FROM identities WHERE id = $1 AND user_id = $2`, identityID, userID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrIdentityNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/oidc"
+	"github.com/richiethie/BitDrop.Server/internal/oidc/oidctest"
+)
+
+// setupOIDC configures a provider called "mock" backed by a local issuer and
+// a database with the identity tables
+func setupOIDC(t *testing.T) *oidctest.Issuer {
+	t.Helper()
+	useUsersDB(t, migration(t, "0013_identities.sql"))
+
+	iss, err := oidctest.NewIssuer("bitdrop-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(iss.Close)
+
+	// Runs after t.Setenv has restored the environment
+	t.Cleanup(func() { _ = oidc.Init() })
+	t.Setenv("OIDC_PROVIDERS", "mock")
+	t.Setenv("OIDC_MOCK_ISSUER", iss.URL())
+	t.Setenv("OIDC_MOCK_CLIENT_ID", iss.ClientID)
+	t.Setenv("OIDC_MOCK_REDIRECT_URL", "https://app.example/auth/mock/callback")
+	if err := oidc.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return iss
+}
+
+// signInWith runs the whole flow: start, sign in at the issuer with claims,
+// then the callback
+func signInWith(t *testing.T, iss *oidctest.Issuer, linkUserID string, claims jwt.MapClaims) (*OIDCResult, error) {
+	t.Helper()
+	ctx := context.Background()
+	start, err := StartOIDC(ctx, "mock", "Test device", linkUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := iss.Authorize(start.AuthorizationURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FinishOIDC(ctx, "mock", code, start.State)
+}
+
+func insertTestUser(t *testing.T, email string, verified bool) string {
+	t.Helper()
+	id := uuid.NewString()
+	_, err := db.DB.Exec(context.Background(), `
+		INSERT INTO users (id, email, username, password, email_verified) VALUES ($1, $2, $3, 'hash', $4)
+	`, id, email, "user_"+id[:8], verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func identityOwner(t *testing.T, subject string) string {
+	t.Helper()
+	var userID string
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT COALESCE((SELECT user_id::text FROM identities WHERE provider = 'mock' AND subject = $1), '')
+	`, subject).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+func TestFinishOIDCNewUser(t *testing.T) {
+	iss := setupOIDC(t)
+	claims := jwt.MapClaims{"sub": "new-1", "email": "New@Example.com", "email_verified": true}
+
+	first, err := signInWith(t, iss, "", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Linked || first.DeviceName != "Test device" {
+		t.Errorf("result = %+v", first)
+	}
+	user, err := GetUserByID(context.Background(), first.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "new@example.com" || !user.EmailVerified {
+		t.Errorf("user = %+v, want a verified new@example.com", user)
+	}
+	if got := identityOwner(t, "new-1"); got != first.UserID {
+		t.Errorf("identity owner = %q, want %q", got, first.UserID)
+	}
+
+	again, err := signInWith(t, iss, "", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.UserID != first.UserID {
+		t.Errorf("second login user = %s, want %s", again.UserID, first.UserID)
+	}
+}
+
+func TestFinishOIDCExistingAccount(t *testing.T) {
+	iss := setupOIDC(t)
+	verified := insertTestUser(t, "verified@example.com", true)
+	insertTestUser(t, "unverified@example.com", false)
+
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		wantUser string
+		wantErr  error
+	}{
+		{
+			name:     "both sides verified links the account",
+			claims:   jwt.MapClaims{"sub": "sub-1", "email": "verified@example.com", "email_verified": true},
+			wantUser: verified,
+		},
+		{
+			name:    "provider email not verified",
+			claims:  jwt.MapClaims{"sub": "sub-2", "email": "verified@example.com", "email_verified": false},
+			wantErr: ErrAccountExists,
+		},
+		{
+			name:    "account email not verified",
+			claims:  jwt.MapClaims{"sub": "sub-3", "email": "unverified@example.com", "email_verified": true},
+			wantErr: ErrAccountExists,
+		},
+		{
+			name:    "no email",
+			claims:  jwt.MapClaims{"sub": "sub-4"},
+			wantErr: ErrEmailRequired,
+		},
+		{
+			name:     "email case and spacing don't matter",
+			claims:   jwt.MapClaims{"sub": "sub-5", "email": " Verified@Example.COM", "email_verified": true},
+			wantUser: verified,
+		},
+		{
+			name:    "unverified email doesn't create an account",
+			claims:  jwt.MapClaims{"sub": "sub-6", "email": "fresh@example.com", "email_verified": false},
+			wantErr: ErrEmailNotVerified,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := signInWith(t, iss, "", tt.claims)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && result.UserID != tt.wantUser {
+				t.Errorf("user = %s, want %s", result.UserID, tt.wantUser)
+			}
+			if got := identityOwner(t, tt.claims["sub"].(string)); got != tt.wantUser {
+				t.Errorf("identity owner = %q, want %q", got, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestFinishOIDCLink(t *testing.T) {
+	iss := setupOIDC(t)
+	alice := insertTestUser(t, "alice@example.com", true)
+	bob := insertTestUser(t, "bob@example.com", true)
+	// The provider email doesn't need to match when a logged-in user links
+	claims := jwt.MapClaims{"sub": "shared-sub", "email": "someone@else.example", "email_verified": false}
+
+	result, err := signInWith(t, iss, alice, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Linked || result.UserID != alice {
+		t.Errorf("result = %+v, want linked to %s", result, alice)
+	}
+
+	if _, err := signInWith(t, iss, bob, claims); !errors.Is(err, ErrIdentityLinkedElsewhere) {
+		t.Errorf("err = %v, want ErrIdentityLinkedElsewhere", err)
+	}
+	if got := identityOwner(t, "shared-sub"); got != alice {
+		t.Errorf("identity owner = %q, want %q", got, alice)
+	}
+
+	// Logging in with the linked identity now reaches alice
+	result, err = signInWith(t, iss, "", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Linked || result.UserID != alice {
+		t.Errorf("result = %+v, want a login as %s", result, alice)
+	}
+}
+
+func TestFinishOIDCRejectsBadTokens(t *testing.T) {
+	iss := setupOIDC(t)
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"bad nonce", jwt.MapClaims{"nonce": "replayed-nonce"}},
+		{"bad aud", jwt.MapClaims{"aud": "another-client"}},
+		{"bad iss", jwt.MapClaims{"iss": "https://evil.example"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.claims["sub"] = "attacker"
+			tt.claims["email"] = "victim@example.com"
+			tt.claims["email_verified"] = true
+			if _, err := signInWith(t, iss, "", tt.claims); !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Errorf("err = %v, want ErrInvalidIDToken", err)
+			}
+			if got := identityOwner(t, "attacker"); got != "" {
+				t.Errorf("identity was created for %s", got)
+			}
+		})
+	}
+}
+
+func TestFinishOIDCStateIsSingleUse(t *testing.T) {
+	iss := setupOIDC(t)
+	ctx := context.Background()
+	start, err := StartOIDC(ctx, "mock", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{"sub": "once", "email": "once@example.com", "email_verified": true}
+	code, err := iss.Authorize(start.AuthorizationURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FinishOIDC(ctx, "mock", code, start.State); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err = iss.Authorize(start.AuthorizationURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FinishOIDC(ctx, "mock", code, start.State); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("err = %v, want ErrInvalidOIDCState", err)
+	}
+	if _, err := FinishOIDC(ctx, "mock", code, "made-up-state"); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("err = %v, want ErrInvalidOIDCState", err)
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+// Failed logins are counted per account and per IP in Postgres so every API
+// instance sees the same counters. Past a threshold each further failure
+// locks the key for exponentially longer, up to maxLockout.
+const (
+	accountFailureThreshold = 5
+	ipFailureThreshold      = 20
+	baseLockout             = 30 * time.Second
+	maxLockout              = time.Hour
+	// failureWindow is how long a key has to go without failures before its count resets
+	failureWindow = 24 * time.Hour
+)
+
+// LoginThrottle is the throttling state for a login attempt
+type LoginThrottle struct {
+	// RetryAfter is how long until the account or IP may try again, zero if not locked
+	RetryAfter time.Duration
+	// CaptchaRequired tells the client to show a CAPTCHA before the next attempt
+	CaptchaRequired bool
+}
+
+// captchaThreshold is how many account failures trigger CAPTCHA signaling
+// (LOGIN_CAPTCHA_AFTER, default 3, 0 disables it)
+func captchaThreshold() int {
+	if v, err := strconv.Atoi(os.Getenv("LOGIN_CAPTCHA_AFTER")); err == nil && v >= 0 {
+		return v
+	}
+	return 3
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// CheckLoginThrottle reports whether logins for email from ip are currently locked
+func CheckLoginThrottle(ctx context.Context, email, ip string) (LoginThrottle, error) {
+	rows, err := db.DB.Query(ctx, `
+		SELECT key, failures, locked_until FROM login_throttles
+		WHERE key IN ($1, $2) AND last_failure_at > $3
+	`, accountThrottleKey(email), ipThrottleKey(ip), time.Now().Add(-failureWindow))
+	if err != nil {
+		return LoginThrottle{}, err
+	}
+	defer rows.Close()
+
+	var t LoginThrottle
+	for rows.Next() {
+		var key string
+		var failures int
+		var lockedUntil *time.Time
+		if err := rows.Scan(&key, &failures, &lockedUntil); err != nil {
+			return LoginThrottle{}, err
+		}
+		t.merge(key, failures, lockedUntil)
+	}
+	return t, rows.Err()
+}
+
+// RecordLoginFailure counts a failed login for email and ip and applies any lockout
+func RecordLoginFailure(ctx context.Context, email, ip string) (LoginThrottle, error) {
+	var t LoginThrottle
+	for _, key := range []string{accountThrottleKey(email), ipThrottleKey(ip)} {
+		failures, lockedUntil, err := recordFailure(ctx, key, ip)
+		if err != nil {
+			return LoginThrottle{}, err
+		}
+		t.merge(key, failures, lockedUntil)
+	}
+	return t, nil
+}
+
+// ClearLoginFailures resets the account counter after a successful login.
+// The IP counter is left alone so one good account can't unlock an attacker's IP.
+func ClearLoginFailures(ctx context.Context, email string) error {
+	_, err := db.DB.Exec(ctx, `DELETE FROM login_throttles WHERE key = $1`, accountThrottleKey(email))
+	return err
+}
+
+func (t *LoginThrottle) merge(key string, failures int, lockedUntil *time.Time) {
+	if lockedUntil != nil {
+		if d := time.Until(*lockedUntil); d > t.RetryAfter {
+			t.RetryAfter = d
+		}
+	}
+	if n := captchaThreshold(); n > 0 && strings.HasPrefix(key, "account:") && failures >= n {
+		t.CaptchaRequired = true
+	}
+}
+
+// lockoutFor is how long key is locked after its failures-th failure in a
+// row, zero while it's under its threshold
+func lockoutFor(key string, failures int) time.Duration {
+	threshold := accountFailureThreshold
+	if strings.HasPrefix(key, "ip:") {
+		threshold = ipFailureThreshold
+	}
+	if failures < threshold {
+		return 0
+	}
+	lockout := baseLockout << min(failures-threshold, 16)
+	if lockout > maxLockout {
+		return maxLockout
+	}
+	return lockout
+}
+
+// recordFailure bumps the counter for key and locks it once past its threshold
+func recordFailure(ctx context.Context, key, ip string) (int, *time.Time, error) {
+	var failures int
+	var lockedUntil *time.Time
+	var lockout time.Duration
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO login_throttles (key, failures, last_failure_at)
+			VALUES ($1, 1, NOW())
+			ON CONFLICT (key) DO UPDATE SET
+				failures = CASE WHEN login_throttles.last_failure_at < $2 THEN 1 ELSE login_throttles.failures + 1 END,
+				locked_until = CASE WHEN login_throttles.last_failure_at < $2 THEN NULL ELSE login_throttles.locked_until END,
+				last_failure_at = NOW()
+			RETURNING failures, locked_until
+		`, key, time.Now().Add(-failureWindow)).Scan(&failures, &lockedUntil)
+		if err != nil {
+			return err
+		}
+		if lockout = lockoutFor(key, failures); lockout == 0 {
+			return nil
+		}
+		until := time.Now().Add(lockout)
+		lockedUntil = &until
+
+		if _, err := tx.Exec(ctx, `UPDATE login_throttles SET locked_until = $2 WHERE key = $1`, key, until); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO login_lockouts (id, key, failures, ip, locked_until, created_at)
+			VALUES ($1, $2, $3, $4, $5, NOW())
+		`, uuid.New(), key, failures, ip, until)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if lockout > 0 {
+		log.Printf("🔒 Locked %s for %s after %d failed logins", key, lockout, failures)
+	}
+	return failures, lockedUntil, nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+func TestLockoutFor(t *testing.T) {
+	tests := []struct {
+		key      string
+		failures int
+		want     time.Duration
+	}{
+		{"account:a@example.com", 1, 0},
+		{"account:a@example.com", 4, 0},
+		{"account:a@example.com", 5, 30 * time.Second},
+		{"account:a@example.com", 6, time.Minute},
+		{"account:a@example.com", 7, 2 * time.Minute},
+		{"account:a@example.com", 11, 32 * time.Minute},
+		{"account:a@example.com", 12, time.Hour},
+		{"account:a@example.com", 1000, time.Hour},
+		{"ip:203.0.113.7", 5, 0},
+		{"ip:203.0.113.7", 19, 0},
+		{"ip:203.0.113.7", 20, 30 * time.Second},
+		{"ip:203.0.113.7", 21, time.Minute},
+		{"ip:203.0.113.7", 200, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := lockoutFor(tt.key, tt.failures); got != tt.want {
+			t.Errorf("lockoutFor(%s, %d) = %v, want %v", tt.key, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottleMerge(t *testing.T) {
+	soon := time.Now().Add(time.Minute)
+	later := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name        string
+		captchaEnv  string
+		keys        []string
+		failures    []int
+		locked      []*time.Time
+		wantLocked  time.Duration // lower bound, zero means not locked
+		wantCaptcha bool
+	}{
+		{
+			name:     "no failures",
+			keys:     []string{"account:a", "ip:1"},
+			failures: []int{0, 0},
+			locked:   []*time.Time{nil, nil},
+		},
+		{
+			name:        "account past the CAPTCHA threshold",
+			keys:        []string{"account:a"},
+			failures:    []int{3},
+			locked:      []*time.Time{nil},
+			wantCaptcha: true,
+		},
+		{
+			name:     "IP failures don't ask for a CAPTCHA",
+			keys:     []string{"ip:1"},
+			failures: []int{10},
+			locked:   []*time.Time{nil},
+		},
+		{
+			name:        "the longer lockout wins",
+			keys:        []string{"account:a", "ip:1"},
+			failures:    []int{5, 25},
+			locked:      []*time.Time{&soon, &later},
+			wantLocked:  59 * time.Minute,
+			wantCaptcha: true,
+		},
+		{
+			name:        "expired lockout",
+			keys:        []string{"account:a"},
+			failures:    []int{5},
+			locked:      []*time.Time{&past},
+			wantCaptcha: true,
+		},
+		{
+			name:       "CAPTCHA disabled",
+			captchaEnv: "0",
+			keys:       []string{"account:a"},
+			failures:   []int{50},
+			locked:     []*time.Time{&soon},
+			wantLocked: 59 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOGIN_CAPTCHA_AFTER", tt.captchaEnv)
+			var th LoginThrottle
+			for i, key := range tt.keys {
+				th.merge(key, tt.failures[i], tt.locked[i])
+			}
+			if (th.RetryAfter > 0) != (tt.wantLocked > 0) || th.RetryAfter < tt.wantLocked {
+				t.Errorf("RetryAfter = %v, want at least %v", th.RetryAfter, tt.wantLocked)
+			}
+			if th.CaptchaRequired != tt.wantCaptcha {
+				t.Errorf("CaptchaRequired = %v, want %v", th.CaptchaRequired, tt.wantCaptcha)
+			}
+		})
+	}
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	useTestDB(t, migration(t, "0014_login_throttles.sql"))
+	ctx := context.Background()
+	const email, ip = "Victim@Example.com", "203.0.113.7"
+
+	for i := 1; i < accountFailureThreshold; i++ {
+		th, err := RecordLoginFailure(ctx, email, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if th.RetryAfter != 0 {
+			t.Fatalf("locked after %d failures", i)
+		}
+	}
+	th, err := RecordLoginFailure(ctx, email, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th.RetryAfter <= 0 || th.RetryAfter > baseLockout {
+		t.Errorf("RetryAfter = %v after %d failures, want up to %v", th.RetryAfter, accountFailureThreshold, baseLockout)
+	}
+
+	// The lock applies to the account however the email is written, and from any IP
+	th, err = CheckLoginThrottle(ctx, " victim@example.com", "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th.RetryAfter <= 0 {
+		t.Error("account is not locked from another IP")
+	}
+
+	// Another account from the same IP is still allowed; the IP threshold is higher
+	if th, err = CheckLoginThrottle(ctx, "other@example.com", ip); err != nil || th.RetryAfter != 0 {
+		t.Errorf("other account: %+v, %v", th, err)
+	}
+
+	var lockouts int
+	if err := db.DB.QueryRow(ctx, `SELECT COUNT(*) FROM login_lockouts WHERE key = 'account:victim@example.com'`).Scan(&lockouts); err != nil || lockouts != 1 {
+		t.Errorf("lockouts recorded = %d, %v", lockouts, err)
+	}
+
+	// A successful login clears the account but not the IP
+	if err := ClearLoginFailures(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	if th, err = CheckLoginThrottle(ctx, email, "198.51.100.1"); err != nil || th.RetryAfter != 0 {
+		t.Errorf("after clearing: %+v, %v", th, err)
+	}
+	var ipFailures int
+	if err := db.DB.QueryRow(ctx, `SELECT failures FROM login_throttles WHERE key = 'ip:203.0.113.7'`).Scan(&ipFailures); err != nil || ipFailures != accountFailureThreshold {
+		t.Errorf("IP failures = %d, %v, want %d", ipFailures, err, accountFailureThreshold)
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+)
+
+// Profile field limits, in characters
+const (
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 300
+)
+
+// ErrProfileFieldTooLong is returned when a display name or bio is over its limit
+var ErrProfileFieldTooLong = fmt.Errorf("display names are at most %d characters and bios at most %d", MaxDisplayNameLength, MaxBioLength)
+
+// UsernameCooldownError is returned when the user changed their username too
+// recently to change it again
+type UsernameCooldownError struct {
+	Until time.Time
+}
+
+func (e *UsernameCooldownError) Error() string {
+	return "username was changed too recently"
+}
+
+// UsernameChangeCooldown is the minimum time between username changes
+// (USERNAME_CHANGE_COOLDOWN, default 30 days)
+func UsernameChangeCooldown() time.Duration {
+	return envDuration("USERNAME_CHANGE_COOLDOWN", 30*24*time.Hour)
+}
+
+// UpdateProfile applies the fields set in req to the user's profile.
+// Username changes are rate limited and recorded in username_history.
+func UpdateProfile(ctx context.Context, userID string, req models.UpdateProfileRequest) (*models.User, error) {
+	if req.DisplayName != nil {
+		name := strings.TrimSpace(*req.DisplayName)
+		if utf8.RuneCountInString(name) > MaxDisplayNameLength {
+			return nil, ErrProfileFieldTooLong
+		}
+		req.DisplayName = &name
+	}
+	if req.Bio != nil {
+		bio := strings.TrimSpace(*req.Bio)
+		if utf8.RuneCountInString(bio) > MaxBioLength {
+			return nil, ErrProfileFieldTooLong
+		}
+		req.Bio = &bio
+	}
+	if req.Username != nil {
+		username, err := ValidateUsername(*req.Username)
+		if err != nil {
+			return nil, err
+		}
+		req.Username = &username
+	}
+
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		if req.Username != nil {
+			if err := changeUsername(ctx, tx, userID, *req.Username); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE users
+			SET display_name = COALESCE($2, display_name), bio = COALESCE($3, bio)
+			WHERE id = $1
+		`, userID, req.DisplayName, req.Bio)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(ctx, userID)
+}
+
+// changeUsername renames the user within tx, enforcing the cooldown since
+// their last change
+func changeUsername(ctx context.Context, tx pgx.Tx, userID, username string) error {
+	var current string
+	// Lock the row so concurrent changes can't both pass the cooldown check
+	err := tx.QueryRow(ctx, `SELECT username FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if current == username {
+		return nil
+	}
+
+	var lastChange *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT MAX(changed_at) FROM username_history WHERE user_id = $1
+	`, userID).Scan(&lastChange)
+	if err != nil {
+		return err
+	}
+	// Changing only the case of a username doesn't use up the cooldown
+	if lastChange != nil && !strings.EqualFold(current, username) {
+		if until := lastChange.Add(UsernameChangeCooldown()); time.Now().Before(until) {
+			return &UsernameCooldownError{Until: until}
+		}
+	}
+
+	var taken bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(username) = $1 AND id <> $2)
+	`, username, userID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrUsernameTaken
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET username = $2, needs_onboarding = false WHERE id = $1`, userID, username)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrUsernameTaken
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO username_history (user_id, old_username, new_username, changed_at)
+		VALUES ($1, $2, $3, NOW())
+	`, userID, current, username)
+	return err
+}
+
+// UsernameHistory returns the user's previous usernames, newest first
+func UsernameHistory(ctx context.Context, userID string) ([]models.UsernameChange, error) {
+	rows, err := db.DB.Query(ctx, `
+		SELECT old_username, new_username, changed_at
+		FROM username_history WHERE user_id = $1
+		ORDER BY changed_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.UsernameChange{}
+	for rows.Next() {
+		var ch models.UsernameChange
+		if err := rows.Scan(&ch.OldUsername, &ch.NewUsername, &ch.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, ch)
+	}
+	return changes, rows.Err()
+}
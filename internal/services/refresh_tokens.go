@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// ErrRefreshTokenReused is returned when an already-rotated refresh token is
+// presented again. The whole token family is revoked when this happens, since
+// either the client or an attacker holds a stolen copy.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// RefreshTokenTTL is how long a refresh token stays valid (REFRESH_TOKEN_TTL, default 30 days)
+func RefreshTokenTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * 24 * time.Hour
+}
+
+// HashToken returns the hex SHA-256 of an opaque token, which is what we store
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewOpaqueToken returns a random URL-safe token
+func NewOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// insertRefreshToken stores a new token in familyID and returns the raw token
+func insertRefreshToken(ctx context.Context, e db.Execer, userID string, familyID uuid.UUID) (string, error) {
+	token, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = e.Exec(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, NOW(), $5)
+	`, uuid.New(), userID, familyID, HashToken(token), time.Now().Add(RefreshTokenTTL()))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken exchanges a valid refresh token for a new one in the
+// same family. It returns the owning user ID, the family ID and the new token.
+func RotateRefreshToken(ctx context.Context, token string) (string, uuid.UUID, string, error) {
+	var userID, newToken string
+	var familyID uuid.UUID
+	reused := false
+
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		var id uuid.UUID
+		var expiresAt time.Time
+		var usedAt, revokedAt *time.Time
+		err := tx.QueryRow(ctx, `
+			SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+			FROM refresh_tokens WHERE token_hash = $1
+			FOR UPDATE
+		`, HashToken(token)).Scan(&id, &userID, &familyID, &expiresAt, &usedAt, &revokedAt)
+		if err == pgx.ErrNoRows {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if revokedAt != nil {
+			return ErrInvalidRefreshToken
+		}
+		if usedAt != nil {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+		if time.Now().After(expiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, id); err != nil {
+			return err
+		}
+		newToken, err = insertRefreshToken(ctx, tx, userID, familyID)
+		return err
+	})
+
+	if reused {
+		// Revoke outside the rolled-back transaction so it sticks
+		log.Printf("⚠️ Refresh token reuse detected for user %s, revoking family %s", userID, familyID)
+		if err := RevokeTokenFamily(ctx, familyID); err != nil {
+			log.Printf("❌ Error revoking token family: %v", err)
+		}
+	}
+	if err != nil {
+		return "", uuid.Nil, "", err
+	}
+	return userID, familyID, newToken, nil
+}
+
+// RevokeTokenFamily revokes every refresh token in a family and the session
+// it belongs to
+func RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	return pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL
+		`, familyID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL
+		`, familyID)
+		return err
+	})
+}
+
+// RevokeRefreshToken revokes the family the given raw token belongs to.
+// Unknown tokens are ignored so logout is idempotent.
+func RevokeRefreshToken(ctx context.Context, token string) error {
+	var familyID uuid.UUID
+	err := db.DB.QueryRow(ctx, `SELECT family_id FROM refresh_tokens WHERE token_hash = $1`, HashToken(token)).Scan(&familyID)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeTokenFamily(ctx, familyID)
+}
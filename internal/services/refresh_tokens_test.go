@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+func TestRefreshTokenTTL(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", 30 * 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"not-a-duration", 30 * 24 * time.Hour},
+		{"-1h", 30 * 24 * time.Hour},
+		{"0s", 30 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Setenv("REFRESH_TOKEN_TTL", tt.env)
+		if got := RefreshTokenTTL(); got != tt.want {
+			t.Errorf("REFRESH_TOKEN_TTL=%q: got %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// sha256("abc")
+	if got, want := HashToken("abc"), "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; got != want {
+		t.Errorf("HashToken = %s, want %s", got, want)
+	}
+	a, _ := NewOpaqueToken()
+	b, _ := NewOpaqueToken()
+	if a == b || len(a) != 43 {
+		t.Errorf("NewOpaqueToken returned %q and %q", a, b)
+	}
+}
+
+func useSessionDB(t *testing.T) string {
+	t.Helper()
+	useUsersDB(t, migration(t, "0009_refresh_tokens.sql"), migration(t, "0010_sessions.sql"))
+	return insertTestUser(t, "sessions@example.com", true)
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	userID := useSessionDB(t)
+	ctx := context.Background()
+	first, sessionID, err := StartSession(ctx, userID, ClientInfo{DeviceName: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotUser, family, second, err := RotateRefreshToken(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotUser != userID || family != sessionID || second == first {
+		t.Errorf("rotation = %s %s %q, want %s %s and a new token", gotUser, family, second, userID, sessionID)
+	}
+
+	third := second
+	for i := 0; i < 3; i++ {
+		if _, _, third, err = RotateRefreshToken(ctx, third); err != nil {
+			t.Fatalf("rotation %d: %v", i, err)
+		}
+	}
+	if active, _ := SessionActive(ctx, sessionID.String()); !active {
+		t.Error("session was revoked by normal rotation")
+	}
+
+	if _, _, _, err := RotateRefreshToken(ctx, "unknown-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRotateRefreshTokenReuse(t *testing.T) {
+	userID := useSessionDB(t)
+	ctx := context.Background()
+	stolen, sessionID, err := StartSession(ctx, userID, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, otherSession, err := StartSession(ctx, userID, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The legitimate client rotates, then the stolen copy is replayed
+	_, _, current, err := RotateRefreshToken(ctx, stolen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := RotateRefreshToken(ctx, stolen); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replay: err = %v, want ErrRefreshTokenReused", err)
+	}
+
+	// The whole family and its session are gone, including the newest token
+	if _, _, _, err := RotateRefreshToken(ctx, current); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("newest token after reuse: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, _, _, err := RotateRefreshToken(ctx, stolen); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("second replay: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if active, _ := SessionActive(ctx, sessionID.String()); active {
+		t.Error("session is still active after reuse")
+	}
+
+	// Other sessions are untouched
+	if active, _ := SessionActive(ctx, otherSession.String()); !active {
+		t.Error("an unrelated session was revoked")
+	}
+	if _, _, _, err := RotateRefreshToken(ctx, other); err != nil {
+		t.Errorf("unrelated session: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenExpired(t *testing.T) {
+	userID := useSessionDB(t)
+	ctx := context.Background()
+	token, sessionID, err := StartSession(ctx, userID, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.Exec(ctx, `UPDATE refresh_tokens SET expires_at = NOW() - INTERVAL '1 minute'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := RotateRefreshToken(ctx, token); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("err = %v, want ErrInvalidRefreshToken", err)
+	}
+	// Expiry isn't a sign of theft, so the session stays
+	if active, _ := SessionActive(ctx, sessionID.String()); !active {
+		t.Error("an expired token revoked its session")
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/models"
+)
+
+// ErrSessionNotFound is returned when a session doesn't exist, belongs to
+// another user or has already been revoked
+var ErrSessionNotFound = errors.New("session not found")
+
+// ClientInfo describes the device a request came from
+type ClientInfo struct {
+	DeviceName string
+	UserAgent  string
+	IP         string
+}
+
+// StartSession records a new session for userID and issues the first refresh
+// token of its family. It returns the raw refresh token and the session ID.
+func StartSession(ctx context.Context, userID string, client ClientInfo) (string, uuid.UUID, error) {
+	sessionID := uuid.New()
+	var token string
+
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO sessions (id, user_id, device_name, user_agent, ip, created_at, last_seen_at)
+			VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		`, sessionID, userID, client.DeviceName, client.UserAgent, client.IP)
+		if err != nil {
+			return err
+		}
+		token, err = insertRefreshToken(ctx, tx, userID, sessionID)
+		return err
+	})
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+	return token, sessionID, nil
+}
+
+// TouchSession bumps last_seen_at and records where the session was last used from
+func TouchSession(ctx context.Context, sessionID uuid.UUID, client ClientInfo) error {
+	_, err := db.DB.Exec(ctx, `
+		UPDATE sessions SET last_seen_at = NOW(), user_agent = $2, ip = $3 WHERE id = $1
+	`, sessionID, client.UserAgent, client.IP)
+	return err
+}
+
+// SessionActive reports whether sessionID exists and hasn't been revoked
+func SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	var active bool
+	err := db.DB.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL)
+	`, sessionID).Scan(&active)
+	return active, err
+}
+
+// ListSessions returns the user's active sessions, most recently used first.
+// The session matching currentID is flagged as current.
+func ListSessions(ctx context.Context, userID, currentID string) ([]models.Session, error) {
+	rows, err := db.DB.Query(ctx, `
+		SELECT id, device_name, user_agent, ip, created_at, last_seen_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var s models.Session
+		if err := rows.Scan(&s.ID, &s.DeviceName, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		s.Current = s.ID == currentID
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes one of the user's sessions along with its refresh tokens
+func RevokeSession(ctx context.Context, userID string, sessionID uuid.UUID) error {
+	var owner string
+	err := db.DB.QueryRow(ctx, `
+		SELECT user_id FROM sessions WHERE id = $1 AND revoked_at IS NULL
+	`, sessionID).Scan(&owner)
+	if err == pgx.ErrNoRows || (err == nil && owner != userID) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeTokenFamily(ctx, sessionID)
+}
+
+// RevokeOtherSessions revokes every session of the user except keepID and
+// returns how many were revoked. Pass an empty keepID to revoke them all.
+func RevokeOtherSessions(ctx context.Context, userID, keepID string) (int64, error) {
+	var revoked int64
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE sessions SET revoked_at = NOW()
+			WHERE user_id = $1 AND revoked_at IS NULL AND id::text <> $2
+		`, userID, keepID)
+		if err != nil {
+			return err
+		}
+		revoked = tag.RowsAffected()
+		_, err = tx.Exec(ctx, `
+			UPDATE refresh_tokens SET revoked_at = NOW()
+			WHERE user_id = $1 AND revoked_at IS NULL AND family_id::text <> $2
+		`, userID, keepID)
+		return err
+	})
+	return revoked, err
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/utils"
+)
+
+// TokenPurposeMFAChallenge is the purpose of the token handed out after a
+// correct password when the account has 2FA enabled
+const TokenPurposeMFAChallenge = "mfa_challenge"
+
+// MFAChallengeTTL is how long the user has to enter their code after the password step
+const MFAChallengeTTL = 5 * time.Minute
+
+// maxChallengeAttempts is how many wrong codes a challenge token survives
+const maxChallengeAttempts = 5
+
+const recoveryCodeCount = 10
+
+var (
+	// ErrTOTPAlreadyEnabled is returned when enrolling an account that already has 2FA
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTOTPNotEnrolled is returned when enabling or using 2FA before enrolling
+	ErrTOTPNotEnrolled = errors.New("two-factor authentication is not set up")
+	// ErrInvalidTOTPCode is returned for wrong, expired or replayed codes
+	ErrInvalidTOTPCode = errors.New("invalid two-factor code")
+)
+
+// TOTPStatus describes a user's 2FA setup
+type TOTPStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TOTPEnrollment is what the client needs to add the account to an authenticator app
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TOTPEnabled reports whether the user has 2FA turned on
+func TOTPEnabled(ctx context.Context, userID string) (bool, error) {
+	var enabled bool
+	err := db.DB.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)
+	`, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// GetTOTPStatus returns whether 2FA is on and how many recovery codes remain
+func GetTOTPStatus(ctx context.Context, userID string) (TOTPStatus, error) {
+	var s TOTPStatus
+	err := db.DB.QueryRow(ctx, `
+		SELECT
+			EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL),
+			(SELECT COUNT(*) FROM totp_recovery_codes WHERE user_id = $1 AND used_at IS NULL)
+	`, userID).Scan(&s.Enabled, &s.RecoveryCodesLeft)
+	return s, err
+}
+
+// EnrollTOTP creates a new pending secret for the user, replacing any earlier
+// pending one. 2FA isn't enforced until EnableTOTP confirms a code.
+func EnrollTOTP(ctx context.Context, userID, email string) (*TOTPEnrollment, error) {
+	enabled, err := TOTPEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.DB.Exec(ctx, `
+		INSERT INTO user_totp (user_id, secret, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = NULL
+	`, userID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "BitDrop"
+	}
+	return &TOTPEnrollment{Secret: secret, URI: utils.TOTPURI(issuer, email, secret)}, nil
+}
+
+// EnableTOTP turns 2FA on once the user proves their app produces valid codes.
+// It returns a fresh set of recovery codes, which are only ever shown once.
+func EnableTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	var codes []string
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		var secret string
+		var enabledAt *time.Time
+		err := tx.QueryRow(ctx, `
+			SELECT secret, enabled_at FROM user_totp WHERE user_id = $1 FOR UPDATE
+		`, userID).Scan(&secret, &enabledAt)
+		if err == pgx.ErrNoRows {
+			return ErrTOTPNotEnrolled
+		}
+		if err != nil {
+			return err
+		}
+		if enabledAt != nil {
+			return ErrTOTPAlreadyEnabled
+		}
+
+		step, ok := utils.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return ErrInvalidTOTPCode
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE user_totp SET enabled_at = NOW(), last_used_step = $2 WHERE user_id = $1
+		`, userID, step); err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(ctx, tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTOTP turns 2FA off after checking a current TOTP or recovery code
+func DisableTOTP(ctx context.Context, userID, code string) error {
+	return pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		if err := verifySecondFactor(ctx, tx, userID, code); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a current code
+func RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	var codes []string
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		if err := verifySecondFactor(ctx, tx, userID, code); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(ctx, tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// VerifySecondFactor checks a TOTP or recovery code for a user with 2FA enabled
+func VerifySecondFactor(ctx context.Context, userID, code string) error {
+	return pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		return verifySecondFactor(ctx, tx, userID, code)
+	})
+}
+
+// verifySecondFactor accepts either a 6-digit TOTP code, which can't be
+// replayed, or an unused recovery code, which is used up
+func verifySecondFactor(ctx context.Context, tx pgx.Tx, userID, code string) error {
+	var secret string
+	var lastStep *int64
+	err := tx.QueryRow(ctx, `
+		SELECT secret, last_used_step FROM user_totp
+		WHERE user_id = $1 AND enabled_at IS NOT NULL
+		FOR UPDATE
+	`, userID).Scan(&secret, &lastStep)
+	if err == pgx.ErrNoRows {
+		return ErrTOTPNotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+
+	if step, ok := utils.ValidateTOTP(secret, code, time.Now()); ok {
+		if lastStep != nil && step <= *lastStep {
+			return ErrInvalidTOTPCode
+		}
+		_, err := tx.Exec(ctx, `UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1`, userID, step)
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE totp_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and returns new ones
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID string) ([]string, error) {
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+
+		_, err := tx.Exec(ctx, `
+			INSERT INTO totp_recovery_codes (id, user_id, code_hash, created_at)
+			VALUES ($1, $2, $3, NOW())
+		`, uuid.New(), userID, HashToken(normalizeRecoveryCode(codes[i])))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode lets users type codes with or without the dash, in any case
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// CreateMFAChallenge issues the token a client exchanges, together with a
+// second factor, for real tokens after a correct password
+func CreateMFAChallenge(ctx context.Context, userID string) (string, error) {
+	return CreateUserToken(ctx, userID, TokenPurposeMFAChallenge, MFAChallengeTTL)
+}
+
+// MFAChallengeEmail returns the email of the user a pending challenge belongs
+// to, so wrong codes can be throttled together with wrong passwords
+func MFAChallengeEmail(ctx context.Context, challenge string) (string, error) {
+	var email string
+	err := db.DB.QueryRow(ctx, `
+		SELECT u.email FROM user_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.purpose = $2 AND t.used_at IS NULL AND t.expires_at > NOW()
+	`, HashToken(challenge), TokenPurposeMFAChallenge).Scan(&email)
+	if err == pgx.ErrNoRows {
+		return "", ErrInvalidUserToken
+	}
+	return email, err
+}
+
+// CompleteMFAChallenge checks code against the user behind challenge and
+// returns the user ID. The challenge is used up on success, and after
+// maxChallengeAttempts wrong codes. Callers also count wrong codes with
+// RecordLoginFailure, since a new challenge only takes the password.
+func CompleteMFAChallenge(ctx context.Context, challenge, code string) (string, error) {
+	var userID string
+	err := pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		var id uuid.UUID
+		err := tx.QueryRow(ctx, `
+			SELECT id, user_id FROM user_tokens
+			WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+			FOR UPDATE
+		`, HashToken(challenge), TokenPurposeMFAChallenge).Scan(&id, &userID)
+		if err == pgx.ErrNoRows {
+			return ErrInvalidUserToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := verifySecondFactor(ctx, tx, userID, code); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE user_tokens SET used_at = NOW() WHERE id = $1`, id)
+		return err
+	})
+
+	if err == ErrInvalidTOTPCode {
+		// Count the failure outside the rolled-back transaction
+		_, dbErr := db.DB.Exec(ctx, `
+			UPDATE user_tokens
+			SET attempts = attempts + 1,
+			    used_at = CASE WHEN attempts + 1 >= $3 THEN NOW() ELSE used_at END
+			WHERE token_hash = $1 AND purpose = $2
+		`, HashToken(challenge), TokenPurposeMFAChallenge, maxChallengeAttempts)
+		if dbErr != nil {
+			return "", dbErr
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return userID, nil
+}
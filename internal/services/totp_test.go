@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/richiethie/BitDrop.Server/internal/utils"
+)
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"abcde-fghij", "abcdefghij"},
+		{"ABCDE-FGHIJ", "abcdefghij"},
+		{"  abcdefghij ", "abcdefghij"},
+		{"ab-cde-fghij", "abcdefghij"},
+	}
+	for _, tt := range tests {
+		if got := normalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	useUsersDB(t, migration(t, "0011_email_verification.sql"), migration(t, "0012_totp.sql"))
+	ctx := context.Background()
+	userID := insertTestUser(t, "mfa@example.com", true)
+
+	if err := VerifySecondFactor(ctx, userID, "123456"); !errors.Is(err, ErrTOTPNotEnrolled) {
+		t.Fatalf("before enrolling: err = %v, want ErrTOTPNotEnrolled", err)
+	}
+	enrollment, err := EnrollTOTP(ctx, userID, "mfa@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A pending enrollment isn't a second factor yet
+	if err := VerifySecondFactor(ctx, userID, "123456"); !errors.Is(err, ErrTOTPNotEnrolled) {
+		t.Fatalf("pending enrollment: err = %v, want ErrTOTPNotEnrolled", err)
+	}
+
+	step := time.Now().Unix() / 30
+	code := func(s int64) string {
+		c, err := utils.TOTPCode(enrollment.Secret, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	recovery, err := EnableTOTP(ctx, userID, code(step))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovery) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes", len(recovery))
+	}
+
+	steps := []struct {
+		name string
+		code string
+		want error
+	}{
+		{"code used to enable", code(step), ErrInvalidTOTPCode},
+		{"next code", code(step + 1), nil},
+		{"next code replayed", code(step + 1), ErrInvalidTOTPCode},
+		{"older code", code(step - 1), ErrInvalidTOTPCode},
+		{"wrong code", "000000", ErrInvalidTOTPCode},
+		{"recovery code", recovery[0], nil},
+		{"recovery code reused", recovery[0], ErrInvalidTOTPCode},
+		{"recovery code without the dash, uppercase", strings.ToUpper(strings.ReplaceAll(recovery[1], "-", "")), nil},
+		{"made-up recovery code", "aaaaa-bbbbb", ErrInvalidTOTPCode},
+	}
+	for _, s := range steps {
+		if err := VerifySecondFactor(ctx, userID, s.code); !errors.Is(err, s.want) {
+			t.Errorf("%s: err = %v, want %v", s.name, err, s.want)
+		}
+	}
+}
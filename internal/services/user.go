@@ -2,68 +2,212 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"log"
-	"time"
+	"math/big"
+	"regexp"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/richiethie/BitDrop.Server/internal/db"
 	"github.com/richiethie/BitDrop.Server/internal/models"
 )
 
+// UserColumns are the users columns read by ScanUser, in scan order
+const UserColumns = "id, email, username, display_name, avatar_url, bio, tier, boosts_left, is_admin, email_verified, needs_onboarding, created_at, last_active, deletion_scheduled_at"
+
+// ScanUser scans a row selected with UserColumns into u, followed by any
+// extra columns the query appended
+func ScanUser(row pgx.Row, u *models.User, extra ...any) error {
+	dest := []any{
+		&u.ID, &u.Email, &u.Username, &u.DisplayName, &u.AvatarURL, &u.Bio, &u.Tier, &u.BoostsLeft,
+		&u.IsAdmin, &u.EmailVerified, &u.NeedsOnboarding, &u.CreatedAt, &u.LastActive, &u.DeletionScheduledAt,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// GetUserByID loads a user by ID
+func GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	var user models.User
+	row := db.DB.QueryRow(ctx, `SELECT `+UserColumns+` FROM users WHERE id = $1`, id)
+	if err := ScanUser(row, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ErrUsernameTaken is returned when a username belongs to someone else
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// ErrInvalidUsername is returned for usernames that don't match usernamePattern
+var ErrInvalidUsername = errors.New("usernames are 3-30 lowercase letters, numbers or underscores")
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// ValidateUsername normalizes a username and checks it's well formed
+func ValidateUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !usernamePattern.MatchString(username) {
+		return "", ErrInvalidUsername
+	}
+	return username, nil
+}
+
+// EnsureUser makes sure a user authenticated by an external issuer (e.g.
+// Supabase) has a users row, creating one on first sight. It asks the
+// database every time; a per-process cache would go stale once another
+// instance or the worker deletes the account.
+func EnsureUser(id, email string) error {
+	_, err := GetOrCreateUser(id, email)
+	return err
+}
+
 // GetOrCreateUser tries to fetch the user by ID.
-// If not found, it inserts a new user and returns the created record.
+// If not found, it inserts a new user with a generated username and returns
+// the created record. New users are flagged for onboarding so the client
+// can ask them to pick their own handle.
 func GetOrCreateUser(id string, email string) (*models.User, error) {
-	var user models.User
+	ctx := context.Background()
+	email = strings.ToLower(email)
 
 	// 1. Try to fetch existing user
-	err := db.DB.QueryRow(context.Background(), `
-		SELECT id, email, username, avatar_url, bio, tier, boosts_left, is_admin, created_at, last_active
-		FROM users WHERE id = $1
-	`, id).Scan(
-		&user.ID,
-		&user.Email,
-		&user.Username,
-		&user.AvatarURL,
-		&user.Bio,
-		&user.Tier,
-		&user.BoostsLeft,
-		&user.IsAdmin,
-		&user.CreatedAt,
-		&user.LastActive,
-	)
-
+	user, err := GetUserByID(ctx, id)
 	if err == nil {
-		return &user, nil // user found, return
+		return user, nil // user found, return
+	}
+	if err != pgx.ErrNoRows {
+		return nil, err
 	}
 
-	// 2. Insert new user
-	defaultUsername := "newuser" // or you can generate from email, e.g., email prefix
+	// Another account already owns this email, e.g. a password signup
+	var taken bool
+	if err := db.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, email).Scan(&taken); err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrAccountExists
+	}
 
-	_, err = db.DB.Exec(context.Background(), `
-		INSERT INTO users (
-			id, email, username, avatar_url, bio, tier, boosts_left, is_admin, created_at, last_active
-		)
-		VALUES ($1, $2, $3, '', '', 'free', 0, false, NOW(), NOW())
-	`, id, email, defaultUsername)
+	// 2. Insert new user, retrying if someone grabs the username first
+	for attempt := 0; attempt < 5; attempt++ {
+		username, err := uniqueUsername(ctx, usernameFromEmail(email))
+		if err != nil {
+			return nil, err
+		}
 
+		_, err = db.DB.Exec(ctx, `
+			INSERT INTO users (
+				id, email, username, avatar_url, bio, tier, boosts_left, is_admin, needs_onboarding, created_at, last_active
+			)
+			VALUES ($1, $2, $3, '', '', 'free', 0, false, true, NOW(), NOW())
+			ON CONFLICT (id) DO NOTHING
+		`, id, email, username)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && strings.Contains(pgErr.ConstraintName, "username") {
+			continue
+		}
+		if err != nil {
+			log.Printf("❌ Error inserting user: %v", err)
+			return nil, err
+		}
+
+		// 3. Return the stored row (a concurrent request may have created it first)
+		return GetUserByID(ctx, id)
+	}
+	return nil, fmt.Errorf("could not find a free username for %s", email)
+}
+
+// uniqueUsername returns base if it's free, otherwise base with a random
+// numeric suffix that's free
+func uniqueUsername(ctx context.Context, base string) (string, error) {
+	candidate := base
+	for attempt := 0; attempt < 10; attempt++ {
+		var exists bool
+		err := db.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(username) = $1)`, candidate).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+
+		// Widen the suffix as attempts go on so busy names still resolve quickly
+		digits := int64(1000)
+		if attempt >= 5 {
+			digits = 1000000
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(digits*9))
+		if err != nil {
+			return "", err
+		}
+		suffix := fmt.Sprint(n.Int64() + digits)
+		trimmed := base
+		if len(trimmed)+len(suffix) > 30 {
+			trimmed = trimmed[:30-len(suffix)]
+		}
+		candidate = trimmed + suffix
+	}
+	return "", fmt.Errorf("could not find a free username for %s", base)
+}
+
+// usernameFromEmail suggests a username from the local part of an email address
+func usernameFromEmail(email string) string {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	var b strings.Builder
+	for _, r := range local {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	name := b.String()
+	if len(name) < 3 {
+		return "newuser"
+	}
+	if len(name) > 30 {
+		name = name[:30]
+	}
+	return name
+}
+
+// ErrOnboardingComplete is returned by CompleteOnboarding for users who already
+// picked their username; later changes go through UpdateProfile
+var ErrOnboardingComplete = errors.New("onboarding is already complete")
+
+// CompleteOnboarding sets the username a newly provisioned user picked and
+// clears their onboarding flag
+func CompleteOnboarding(ctx context.Context, userID, username string) (*models.User, error) {
+	username, err := ValidateUsername(username)
 	if err != nil {
-		log.Printf("❌ Error inserting user: %v", err)
 		return nil, err
 	}
 
-	// 3. Return the inserted user data (mirrors default values)
-	now := time.Now()
-	user = models.User{
-		ID:         id,
-		Email:      email,
-		Username:   defaultUsername,
-		AvatarURL:  "",
-		Bio:        "",
-		Tier:       "free",
-		BoostsLeft: 0,
-		IsAdmin:    false,
-		CreatedAt:  now,
-		LastActive: now,
+	var taken bool
+	err = db.DB.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(username) = $1 AND id <> $2)
+	`, username, userID).Scan(&taken)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrUsernameTaken
 	}
 
-	return &user, nil
+	tag, err := db.DB.Exec(ctx, `
+		UPDATE users SET username = $2, needs_onboarding = false WHERE id = $1 AND needs_onboarding
+	`, userID, username)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrOnboardingComplete
+	}
+	return GetUserByID(ctx, userID)
 }
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+func TestCompleteOnboarding(t *testing.T) {
+	useUsersDB(t)
+	ctx := context.Background()
+
+	user, err := GetOrCreateUser(uuid.NewString(), "New.Person@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.NeedsOnboarding || user.Username != "newperson" {
+		t.Fatalf("provisioned user = %+v", user)
+	}
+
+	user, err = CompleteOnboarding(ctx, user.ID, " Picked_Name ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.NeedsOnboarding || user.Username != "picked_name" {
+		t.Errorf("after onboarding = %+v", user)
+	}
+
+	// Renames after onboarding go through UpdateProfile and its cooldown
+	if _, err := CompleteOnboarding(ctx, user.ID, "another_name"); err != ErrOnboardingComplete {
+		t.Errorf("second onboarding err = %v, want ErrOnboardingComplete", err)
+	}
+	user, err = GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "picked_name" {
+		t.Errorf("username = %q after a second onboarding, want picked_name", user.Username)
+	}
+}
+
+func TestUniqueUsernamesMigration(t *testing.T) {
+	useTestDB(t, testUsersTable)
+	ctx := context.Background()
+
+	oldest, second, other := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	_, err := db.DB.Exec(ctx, `
+		INSERT INTO users (id, email, username, created_at) VALUES
+			($1, 'a@example.com', 'newuser', NOW() - INTERVAL '2 days'),
+			($2, 'b@example.com', 'NewUser', NOW() - INTERVAL '1 day'),
+			($3, 'c@example.com', 'someone', NOW())
+	`, oldest, second, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.Exec(ctx, migration(t, "0022_unique_usernames.sql")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id             string
+		wantUsername   string
+		wantOnboarding bool
+	}{
+		{oldest, "newuser", false},
+		{second, "newuser_" + strings.ReplaceAll(second, "-", "")[:8], true},
+		{other, "someone", false},
+	}
+	for _, tt := range tests {
+		user, err := GetUserByID(ctx, tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Username != tt.wantUsername || user.NeedsOnboarding != tt.wantOnboarding {
+			t.Errorf("user %s = %s onboarding=%v, want %s onboarding=%v", tt.id, user.Username, user.NeedsOnboarding, tt.wantUsername, tt.wantOnboarding)
+		}
+	}
+
+	_, err = db.DB.Exec(ctx, `INSERT INTO users (id, email, username) VALUES ($1, 'd@example.com', 'SOMEONE')`, uuid.NewString())
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" || !strings.Contains(pgErr.ConstraintName, "username") {
+		t.Errorf("duplicate username insert err = %v, want a username unique violation", err)
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+)
+
+// Token purposes for single-use emailed tokens
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+)
+
+// ErrInvalidUserToken is returned for unknown, expired or already-used tokens
+var ErrInvalidUserToken = errors.New("invalid or expired token")
+
+// EmailVerificationTTL is how long verification links work (EMAIL_VERIFICATION_TTL, default 24h)
+func EmailVerificationTTL() time.Duration {
+	return envDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+}
+
+// PasswordResetTTL is how long reset links work (PASSWORD_RESET_TTL, default 1h)
+func PasswordResetTTL() time.Duration {
+	return envDuration("PASSWORD_RESET_TTL", time.Hour)
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// CreateUserToken issues a single-use token for purpose and returns it.
+// Any unused tokens the user has for the same purpose stop working.
+func CreateUserToken(ctx context.Context, userID, purpose string, ttl time.Duration) (string, error) {
+	token, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = pgx.BeginFunc(ctx, db.DB, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE user_tokens SET used_at = NOW()
+			WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+		`, userID, purpose)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO user_tokens (id, user_id, purpose, token_hash, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, NOW(), $5)
+		`, uuid.New(), userID, purpose, HashToken(token), time.Now().Add(ttl))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeUserToken marks a token for purpose as used and returns its user ID
+func ConsumeUserToken(ctx context.Context, e db.Querier, token, purpose string) (string, error) {
+	var userID string
+	err := e.QueryRow(ctx, `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, HashToken(token), purpose).Scan(&userID)
+	if err == pgx.ErrNoRows {
+		return "", ErrInvalidUserToken
+	}
+	return userID, err
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Route prefixes LocalStore serves objects under
+const (
+	LocalMountPath        = "/files"
+	LocalPrivateMountPath = "/private-files"
+)
+
+// LocalStore stores objects on the local filesystem and serves them over Gin.
+// It is meant for development and CI where no Supabase project is available.
+type LocalStore struct {
+	root       string
+	baseURL    string
+	mount      string
+	private    bool // reads need a signed URL
+	signingKey []byte
+}
+
+// NewLocalStore returns a store rooted at dir whose public URLs start with
+// baseURL. signingKey authenticates pre-signed URLs; when empty a random key
+// is used, so signed URLs do not survive a restart.
+func NewLocalStore(dir, baseURL, signingKey string) (*LocalStore, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	key := []byte(signingKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &LocalStore{root: root, baseURL: strings.TrimRight(baseURL, "/"), mount: LocalMountPath, signingKey: key}, nil
+}
+
+// NewPrivateLocalStore is NewLocalStore for a store whose objects can only be
+// read through SignURLs
+func NewPrivateLocalStore(dir, baseURL, signingKey string) (*LocalStore, error) {
+	s, err := NewLocalStore(dir, baseURL, signingKey)
+	if err != nil {
+		return nil, err
+	}
+	s.mount = LocalPrivateMountPath
+	s.private = true
+	return s, nil
+}
+
+// path maps a key to a file under root, rejecting keys that escape it
+func (s *LocalStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes r to key, creating parent directories as needed
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Write to a temp file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Get opens the object at key for reading
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete removes the object at key; deleting a missing object is not an error
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Stat returns size and type information for the object at key
+func (s *LocalStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && fi.IsDir()) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         fi.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(p)),
+		LastModified: fi.ModTime(),
+	}, nil
+}
+
+// List returns every object whose key starts with prefix
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          key,
+			Size:         fi.Size(),
+			ContentType:  mime.TypeByExtension(filepath.Ext(p)),
+			LastModified: fi.ModTime(),
+		})
+		return nil
+	})
+	return objects, err
+}
+
+// PublicURL returns the URL the object is served at by RegisterRoutes
+func (s *LocalStore) PublicURL(key string) string {
+	return s.baseURL + s.mount + "/" + key
+}
+
+// sign returns the signature authorizing method on key until expires
+func (s *LocalStore) sign(method, key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(method + "\n" + key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedURL returns a URL authorizing method on key for expiry
+func (s *LocalStore) signedURL(method, key string, expiry time.Duration) (string, time.Time) {
+	expiresAt := time.Now().Add(expiry)
+	q := url.Values{
+		"expires":   {strconv.FormatInt(expiresAt.Unix(), 10)},
+		"signature": {s.sign(method, key, expiresAt.Unix())},
+	}
+	return s.PublicURL(key) + "?" + q.Encode(), expiresAt
+}
+
+// verify checks the signature query parameters on a request for key
+func (s *LocalStore) verify(c *gin.Context, method, key string) bool {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	expected := s.sign(method, key, expires)
+	return hmac.Equal([]byte(expected), []byte(c.Query("signature")))
+}
+
+// SignURLs returns URLs that allow reading keys until expiry
+func (s *LocalStore) SignURLs(ctx context.Context, keys []string, expiry time.Duration) ([]string, error) {
+	urls := make([]string, len(keys))
+	for i, key := range keys {
+		if _, err := s.path(key); err != nil {
+			return nil, err
+		}
+		urls[i], _ = s.signedURL(http.MethodGet, key, expiry)
+	}
+	return urls, nil
+}
+
+// PresignPut returns a signed URL that accepts a PUT of key's contents
+func (s *LocalStore) PresignPut(ctx context.Context, key, contentType string, expiry time.Duration) (*SignedUpload, error) {
+	if _, err := s.path(key); err != nil {
+		return nil, err
+	}
+	u, expiresAt := s.signedURL(http.MethodPut, key, expiry)
+	return &SignedUpload{URL: u, Method: http.MethodPut, ExpiresAt: expiresAt}, nil
+}
+
+// RegisterRoutes serves stored objects under the store's mount path
+func (s *LocalStore) RegisterRoutes(r *gin.Engine) {
+	r.GET(s.mount+"/*key", s.serve)
+	r.HEAD(s.mount+"/*key", s.serve)
+	r.PUT(s.mount+"/*key", s.upload)
+}
+
+// upload accepts a direct upload authorized by a PresignPut URL
+func (s *LocalStore) upload(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !s.verify(c, http.MethodPut, key) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired signature"})
+		return
+	}
+	err := s.Put(c.Request.Context(), key, c.Request.Body, PutOptions{
+		ContentType: c.ContentType(),
+		Size:        c.Request.ContentLength,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store object: " + err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (s *LocalStore) serve(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	p, err := s.path(key)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// HEAD requests reuse the GET signature
+	if s.private && !s.verify(c, http.MethodGet, key) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired signature"})
+		return
+	}
+	if fi, err := os.Stat(p); err != nil || fi.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Object not found"})
+		return
+	}
+	// http.ServeFile handles Range requests, which video players rely on
+	c.File(p)
+}
+
+// RegisterRoutes mounts any routes the configured backend needs to serve objects
+func RegisterRoutes(r *gin.Engine) {
+	for _, store := range []ObjectStore{Default, Private} {
+		if local, ok := store.(*LocalStore); ok {
+			local.RegisterRoutes(r)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimum part size S3 accepts for every part but the last
+const minS3PartSize = 5 << 20
+
+// S3Config configures an S3Store
+type S3Config struct {
+	Endpoint        string // e.g. https://s3.us-east-1.amazonaws.com or http://localhost:9000
+	Region          string
+	Bucket          string
+	Prefix          string // optional key prefix inside the bucket
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool   // address the bucket as endpoint/bucket instead of bucket.endpoint (MinIO)
+	PublicBaseURL   string // optional CDN/public base URL; defaults to the bucket URL
+	PartSize        int64  // multipart part size; objects at least this large use multipart uploads
+}
+
+// S3Store stores objects in any S3-compatible bucket
+type S3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+	signer   sigV4Signer
+	client   *http.Client
+	parts    sync.Pool // *[]byte part buffers of cfg.PartSize
+}
+
+// NewS3Store validates cfg and returns a store for it
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3 endpoint or bucket not set in env")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("S3 credentials not set in env")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PartSize < minS3PartSize {
+		cfg.PartSize = 16 << 20
+	}
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+
+	s := &S3Store{
+		cfg:      cfg,
+		endpoint: endpoint,
+		signer: sigV4Signer{
+			accessKey: cfg.AccessKeyID,
+			secretKey: cfg.SecretAccessKey,
+			region:    cfg.Region,
+			service:   "s3",
+		},
+		client: &http.Client{},
+	}
+	s.parts.New = func() any {
+		buf := make([]byte, cfg.PartSize)
+		return &buf
+	}
+	return s, nil
+}
+
+// fullKey applies the configured prefix to key
+func (s *S3Store) fullKey(key string) string {
+	if s.cfg.Prefix == "" {
+		return key
+	}
+	return s.cfg.Prefix + "/" + key
+}
+
+// objectURL returns the request URL for a key (already prefixed) in the bucket
+func (s *S3Store) objectURL(fullKey string, query url.Values) *url.URL {
+	u := *s.endpoint
+	p := "/" + fullKey
+	if s.cfg.PathStyle {
+		p = "/" + s.cfg.Bucket + p
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + p
+	u.RawPath = awsURIEncode(u.Path, false)
+	if query != nil {
+		u.RawQuery = canonicalQuery(query)
+	}
+	return &u
+}
+
+// do signs and sends a request. body may be nil.
+func (s *S3Store) do(ctx context.Context, method string, u *url.URL, body []byte, header http.Header) (*http.Response, error) {
+	var reader io.Reader
+	payloadHash := emptyPayloadSHA
+	if body != nil {
+		reader = bytes.NewReader(body)
+		payloadHash = sha256Hex(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.signer.sign(req, payloadHash, time.Now())
+	return s.client.Do(req)
+}
+
+// s3Error reads an S3 error response into a Go error
+func s3Error(op string, resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Errorf("%s failed: %s: %s", op, e.Code, e.Message)
+	}
+	return fmt.Errorf("%s failed: %s", op, resp.Status)
+}
+
+// Put uploads r to key. Objects smaller than one part are sent with a single
+// PUT; larger ones are streamed as a multipart upload so only one part is
+// held in memory at a time. Part buffers are pooled, and small objects of
+// known size don't need one.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	if opts.Size > 0 && opts.Size < s.cfg.PartSize {
+		body, err := io.ReadAll(io.LimitReader(r, opts.Size+1))
+		if err != nil {
+			return fmt.Errorf("failed to read upload: %w", err)
+		}
+		if int64(len(body)) != opts.Size {
+			return fmt.Errorf("upload is %d bytes, expected %d", len(body), opts.Size)
+		}
+		return s.putObject(ctx, key, body, contentType)
+	}
+
+	bufp := s.parts.Get().(*[]byte)
+	defer s.parts.Put(bufp)
+	buf := *bufp
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.putObject(ctx, key, buf[:n], contentType)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+	return s.putMultipart(ctx, key, r, buf, contentType)
+}
+
+func (s *S3Store) putObject(ctx context.Context, key string, body []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(s.fullKey(key), nil), body,
+		http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return fmt.Errorf("upload request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("upload", resp)
+	}
+	return nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// putMultipart uploads first (a full part) followed by the rest of r
+func (s *S3Store) putMultipart(ctx context.Context, key string, r io.Reader, first []byte, contentType string) error {
+	fullKey := s.fullKey(key)
+
+	resp, err := s.do(ctx, http.MethodPost, s.objectURL(fullKey, url.Values{"uploads": {""}}), []byte{},
+		http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return fmt.Errorf("create multipart upload failed: %w", err)
+	}
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return s3Error("create multipart upload", resp)
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil || created.UploadID == "" {
+		return fmt.Errorf("invalid create multipart upload response: %v", err)
+	}
+
+	parts, err := s.uploadParts(ctx, fullKey, created.UploadID, r, first)
+	if err != nil {
+		// Abort so the bucket does not accumulate orphaned parts
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if resp, abortErr := s.do(abortCtx, http.MethodDelete,
+			s.objectURL(fullKey, url.Values{"uploadId": {created.UploadID}}), nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	payload, _ := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+
+	resp, err = s.do(ctx, http.MethodPost, s.objectURL(fullKey, url.Values{"uploadId": {created.UploadID}}), payload,
+		http.Header{"Content-Type": {"application/xml"}})
+	if err != nil {
+		return fmt.Errorf("complete multipart upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// S3 can report a failed completion with a 200 status and an Error body
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || bytes.Contains(body, []byte("<Error>")) {
+		return fmt.Errorf("complete multipart upload failed: %s", string(body))
+	}
+	return nil
+}
+
+func (s *S3Store) uploadParts(ctx context.Context, fullKey, uploadID string, r io.Reader, first []byte) ([]completedPart, error) {
+	parts := []completedPart{}
+	buf := first
+	n := len(first)
+	for partNumber := 1; ; partNumber++ {
+		q := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, http.MethodPut, s.objectURL(fullKey, q), buf[:n], nil)
+		if err != nil {
+			return nil, fmt.Errorf("upload part %d failed: %w", partNumber, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, s3Error(fmt.Sprintf("upload part %d", partNumber), resp)
+		}
+		resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+
+		n, err = io.ReadFull(r, buf)
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("failed to read upload: %w", err)
+		}
+	}
+}
+
+// Get opens the object at key for reading
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(s.fullKey(key), nil), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("download request failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3Error("download", resp)
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object at key
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(s.fullKey(key), nil), nil, nil)
+	if err != nil {
+		return fmt.Errorf("delete request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return s3Error("delete", resp)
+	}
+	return nil
+}
+
+// Stat returns size and type information for the object at key
+func (s *S3Store) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL(s.fullKey(key), nil), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("stat request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stat failed: %s", resp.Status)
+	}
+
+	info := &ObjectInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = lm
+	}
+	return info, nil
+}
+
+// List returns every object whose key starts with prefix
+func (s *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {s.fullKey(prefix)}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		// List is a bucket-level operation, so address the bucket root
+		resp, err := s.do(ctx, http.MethodGet, s.objectURL("", q), nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("list request failed: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, s3Error("list", resp)
+		}
+
+		var result struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode list response: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			key := obj.Key
+			if s.cfg.Prefix != "" {
+				key = strings.TrimPrefix(key, s.cfg.Prefix+"/")
+			}
+			objects = append(objects, ObjectInfo{Key: key, Size: obj.Size, LastModified: obj.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	return objects, nil
+}
+
+// PublicURL returns the URL key can be fetched from when the bucket (or a CDN
+// in front of it) allows anonymous reads
+func (s *S3Store) PublicURL(key string) string {
+	fullKey := awsURIEncode(s.fullKey(key), false)
+	if s.cfg.PublicBaseURL != "" {
+		return strings.TrimRight(s.cfg.PublicBaseURL, "/") + "/" + fullKey
+	}
+	return s.objectURL(s.fullKey(key), nil).String()
+}
+
+// SignURLs returns pre-signed GET URLs for keys
+func (s *S3Store) SignURLs(ctx context.Context, keys []string, expiry time.Duration) ([]string, error) {
+	now := time.Now()
+	urls := make([]string, len(keys))
+	for i, key := range keys {
+		urls[i] = s.signer.presign(http.MethodGet, s.objectURL(s.fullKey(key), nil), expiry, now).String()
+	}
+	return urls, nil
+}
+
+// PresignPut returns a pre-signed PUT URL for key
+func (s *S3Store) PresignPut(ctx context.Context, key, contentType string, expiry time.Duration) (*SignedUpload, error) {
+	u := s.signer.presign(http.MethodPut, s.objectURL(s.fullKey(key), nil), expiry, time.Now())
+	headers := map[string]string{}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	return &SignedUpload{
+		URL:       u.String(),
+		Method:    http.MethodPut,
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(expiry),
+	}, nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 records the requests an S3Store makes and accepts every upload
+type fakeS3 struct {
+	mu       sync.Mutex
+	requests []string
+	objects  map[string][]byte
+	parts    map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPut && q.Get("partNumber") != "":
+		f.requests = append(f.requests, "part")
+		f.parts[q.Get("partNumber")] = body
+		w.Header().Set("ETag", `"etag-`+q.Get("partNumber")+`"`)
+	case r.Method == http.MethodPut:
+		f.requests = append(f.requests, "put")
+		f.objects[r.URL.Path] = body
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.requests = append(f.requests, "create")
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>up-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPost && q.Get("uploadId") != "":
+		f.requests = append(f.requests, "complete")
+		var all []byte
+		for i := 1; i <= len(f.parts); i++ {
+			all = append(all, f.parts[fmt.Sprint(i)]...)
+		}
+		f.objects[r.URL.Path] = all
+		fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newTestS3(t *testing.T) (*S3Store, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{objects: map[string][]byte{}, parts: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	store, err := NewS3Store(S3Config{
+		Endpoint:        srv.URL,
+		Bucket:          "bucket",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+		PartSize:        minS3PartSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, fake
+}
+
+func TestS3StorePut(t *testing.T) {
+	small := bytes.Repeat([]byte("a"), 1024)
+	large := bytes.Repeat([]byte("b"), minS3PartSize+100)
+	tests := []struct {
+		name     string
+		data     []byte
+		size     int64
+		requests string
+	}{
+		{"small with known size", small, int64(len(small)), "put"},
+		{"small with unknown size", small, -1, "put"},
+		{"large with known size", large, int64(len(large)), "create,part,part,complete"},
+		{"large with unknown size", large, -1, "create,part,part,complete"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, fake := newTestS3(t)
+			err := store.Put(context.Background(), "k", bytes.NewReader(tt.data), PutOptions{Size: tt.size})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(fake.requests, ","); got != tt.requests {
+				t.Errorf("requests = %s, want %s", got, tt.requests)
+			}
+			if got := fake.objects["/bucket/k"]; !bytes.Equal(got, tt.data) {
+				t.Errorf("stored %d bytes, want %d", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestS3StorePutSizeMismatch(t *testing.T) {
+	store, fake := newTestS3(t)
+	err := store.Put(context.Background(), "k", strings.NewReader("longer than declared"), PutOptions{Size: 4})
+	if err == nil {
+		t.Fatal("expected an error for a body larger than its declared size")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("requests = %v, want none", fake.requests)
+	}
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist in the store
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// PutOptions carries optional metadata for Put. Size is -1 when unknown.
+type PutOptions struct {
+	ContentType string
+	Size        int64
+}
+
+// ObjectStore is the interface every storage backend implements.
+// Keys are slash-separated paths relative to the store's bucket.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	PublicURL(key string) string
+}
+
+// Default is the store used by the handlers, configured by Init. Objects in
+// it are readable by anyone with their PublicURL.
+var Default ObjectStore
+
+// Private holds media that must not be world-readable, such as the videos of
+// non-public drops. Objects in it are only reachable through URLs from its
+// URLSigner.
+var Private ObjectStore
+
+// For returns Private or Default
+func For(private bool) ObjectStore {
+	if private {
+		return Private
+	}
+	return Default
+}
+
+// Init configures Default and Private from the STORAGE_BACKEND env var
+// ("supabase", "s3" or "local")
+func Init() error {
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" {
+		backend = "supabase"
+	}
+
+	bucket := os.Getenv("STORAGE_BUCKET")
+	if bucket == "" {
+		bucket = "drops"
+	}
+	privateBucket := os.Getenv("STORAGE_PRIVATE_BUCKET")
+	if privateBucket == "" {
+		privateBucket = bucket + "-private"
+	}
+
+	var err error
+	switch backend {
+	case "supabase":
+		Default, err = NewSupabaseStore(os.Getenv("SUPABASE_URL"), os.Getenv("SUPABASE_SERVICE_ROLE_KEY"), bucket)
+		if err == nil {
+			Private, err = NewSupabaseStore(os.Getenv("SUPABASE_URL"), os.Getenv("SUPABASE_SERVICE_ROLE_KEY"), privateBucket)
+		}
+	case "s3":
+		partSize, _ := strconv.ParseInt(os.Getenv("S3_PART_SIZE_MB"), 10, 64)
+		cfg := S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Prefix:          os.Getenv("S3_PREFIX"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       os.Getenv("S3_FORCE_PATH_STYLE") == "true",
+			PublicBaseURL:   os.Getenv("S3_PUBLIC_URL"),
+			PartSize:        partSize << 20,
+		}
+		Default, err = NewS3Store(cfg)
+		if err == nil {
+			// The private bucket must not allow anonymous reads
+			cfg.Bucket = os.Getenv("S3_PRIVATE_BUCKET")
+			if cfg.Bucket == "" {
+				cfg.Bucket = os.Getenv("S3_BUCKET") + "-private"
+			}
+			cfg.PublicBaseURL = ""
+			Private, err = NewS3Store(cfg)
+		}
+	case "local":
+		dir := os.Getenv("LOCAL_STORAGE_DIR")
+		if dir == "" {
+			dir = "./data/storage"
+		}
+		privateDir := os.Getenv("LOCAL_PRIVATE_STORAGE_DIR")
+		if privateDir == "" {
+			privateDir = "./data/private"
+		}
+		baseURL := os.Getenv("LOCAL_STORAGE_BASE_URL")
+		if baseURL == "" {
+			port := os.Getenv("PORT")
+			if port == "" {
+				port = "8080"
+			}
+			baseURL = "http://localhost:" + port
+		}
+		signingKey := os.Getenv("LOCAL_STORAGE_SIGNING_KEY")
+		Default, err = NewLocalStore(dir, baseURL, signingKey)
+		if err == nil {
+			Private, err = NewPrivateLocalStore(privateDir, baseURL, signingKey)
+		}
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to initialize %s storage: %w", backend, err)
+	}
+	if _, ok := Private.(URLSigner); !ok {
+		return fmt.Errorf("%s storage cannot sign download URLs", backend)
+	}
+
+	fmt.Printf("📦 Using %s storage backend\n", backend)
+	return nil
+}
+
+// SignedUpload describes a request a client can make to upload an object
+// directly to the store without going through the API server
+type SignedUpload struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Presigner is implemented by stores that can issue direct upload URLs
+type Presigner interface {
+	PresignPut(ctx context.Context, key, contentType string, expiry time.Duration) (*SignedUpload, error)
+}
+
+// URLSigner is implemented by stores that can issue time-limited download
+// URLs. SignURLs returns one URL per key, in order; keys the store can't sign,
+// such as missing objects, may get an empty URL.
+type URLSigner interface {
+	SignURLs(ctx context.Context, keys []string, expiry time.Duration) ([]string, error)
+}
+
+// Copy copies the object at key from src to dst
+func Copy(ctx context.Context, src, dst ObjectStore, key string) error {
+	info, err := src.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	body, err := src.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return dst.Put(ctx, key, body, PutOptions{ContentType: info.ContentType, Size: info.Size})
+}
+
+// DeletePrefix removes every object in s whose key starts with prefix
+func DeletePrefix(ctx context.Context, s ObjectStore, prefix string) error {
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, obj := range objects {
+		if err := s.Delete(ctx, obj.Key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// DownloadToTemp copies the object at key in s into a temp file and returns
+// its path. The caller removes the file.
+func DownloadToTemp(ctx context.Context, s ObjectStore, key string) (string, error) {
+	body, err := s.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "download-*")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
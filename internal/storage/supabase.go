@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SupabaseStore stores objects in a Supabase Storage bucket
+type SupabaseStore struct {
+	baseURL    string
+	serviceKey string
+	bucket     string
+	client     *http.Client
+}
+
+// NewSupabaseStore returns a store backed by the given Supabase project and bucket
+func NewSupabaseStore(supabaseURL, serviceKey, bucket string) (*SupabaseStore, error) {
+	if supabaseURL == "" || serviceKey == "" {
+		return nil, fmt.Errorf("Supabase URL or service key not set in env")
+	}
+	return &SupabaseStore{
+		baseURL:    strings.TrimRight(supabaseURL, "/"),
+		serviceKey: serviceKey,
+		bucket:     bucket,
+		client:     &http.Client{},
+	}, nil
+}
+
+func (s *SupabaseStore) objectURL(key string) string {
+	return fmt.Sprintf("%s/storage/v1/object/%s/%s", s.baseURL, s.bucket, key)
+}
+
+func (s *SupabaseStore) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	return s.client.Do(req)
+}
+
+// Put uploads r to key, overwriting any existing object
+func (s *SupabaseStore) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.objectURL(key), r)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	if opts.Size >= 0 {
+		req.ContentLength = opts.Size
+	}
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-upsert", "true")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return fmt.Errorf("upload request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("upload failed: %s", string(body))
+	}
+	return nil
+}
+
+// Get opens the object at key for reading
+func (s *SupabaseStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download request failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		// Supabase reports missing objects as 400 "Object not found"
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("download failed: %s", string(body))
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object at key
+func (s *SupabaseStore) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return fmt.Errorf("delete request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete failed: %s", string(body))
+	}
+	return nil
+}
+
+// Stat returns size and type information for the object at key
+func (s *SupabaseStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.objectURL(key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stat request: %w", err)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("stat request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stat failed: %s", resp.Status)
+	}
+
+	info := &ObjectInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = lm
+	}
+	return info, nil
+}
+
+// List returns every object whose key starts with prefix. Supabase lists one
+// folder at a time, so subfolders are walked recursively.
+func (s *SupabaseStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	dir, search := path.Split(prefix)
+	return s.listFolder(ctx, strings.TrimSuffix(dir, "/"), search)
+}
+
+// listFolder lists objects under dir whose names start with search
+func (s *SupabaseStore) listFolder(ctx context.Context, dir, search string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	const pageSize = 1000
+	for offset := 0; ; offset += pageSize {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"prefix": dir,
+			"search": search,
+			"limit":  pageSize,
+			"offset": offset,
+		})
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			fmt.Sprintf("%s/storage/v1/object/list/%s", s.baseURL, s.bucket), bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create list request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, fmt.Errorf("list request failed: %w", err)
+		}
+
+		var entries []struct {
+			Name      string    `json:"name"`
+			ID        *string   `json:"id"`
+			UpdatedAt time.Time `json:"updated_at"`
+			Metadata  struct {
+				Size     json.Number `json:"size"`
+				Mimetype string      `json:"mimetype"`
+			} `json:"metadata"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("list failed: %s", string(body))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&entries)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode list response: %w", err)
+		}
+
+		for _, e := range entries {
+			key := path.Join(dir, e.Name)
+			// Entries without an id are folders
+			if e.ID == nil {
+				nested, err := s.listFolder(ctx, key, "")
+				if err != nil {
+					return nil, err
+				}
+				objects = append(objects, nested...)
+				continue
+			}
+			size, _ := strconv.ParseInt(e.Metadata.Size.String(), 10, 64)
+			objects = append(objects, ObjectInfo{
+				Key:          key,
+				Size:         size,
+				ContentType:  e.Metadata.Mimetype,
+				LastModified: e.UpdatedAt,
+			})
+		}
+		if len(entries) < pageSize {
+			break
+		}
+	}
+	return objects, nil
+}
+
+// PublicURL returns the public URL for key
+// Public URL format: {SUPABASE_URL}/storage/v1/object/public/{bucket}/{key}
+func (s *SupabaseStore) PublicURL(key string) string {
+	return fmt.Sprintf("%s/storage/v1/object/public/%s/%s", s.baseURL, s.bucket, key)
+}
+
+// SignURLs creates signed download URLs for keys in a single request
+func (s *SupabaseStore) SignURLs(ctx context.Context, keys []string, expiry time.Duration) ([]string, error) {
+	if len(keys) == 0 {
+		return []string{}, nil
+	}
+	payload, err := json.Marshal(map[string]any{"expiresIn": int(expiry.Seconds()), "paths": keys})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/storage/v1/object/sign/%s", s.baseURL, s.bucket), bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sign request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sign request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("sign failed: %s", string(body))
+	}
+
+	var signed []struct {
+		Path      string  `json:"path"`
+		SignedURL *string `json:"signedURL"`
+		Error     *string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return nil, fmt.Errorf("failed to decode sign response: %w", err)
+	}
+	byPath := map[string]string{}
+	for _, e := range signed {
+		if e.SignedURL != nil {
+			byPath[e.Path] = s.baseURL + "/storage/v1" + *e.SignedURL
+		}
+	}
+	urls := make([]string, len(keys))
+	for i, key := range keys {
+		urls[i] = byPath[key]
+	}
+	return urls, nil
+}
+
+// Supabase signed upload URLs are always valid for two hours
+const supabaseSignedUploadTTL = 2 * time.Hour
+
+// PresignPut creates a Supabase signed upload URL for key. Supabase does not
+// allow choosing the expiry, so expiry is ignored and the URL's real two-hour
+// lifetime is reported.
+func (s *SupabaseStore) PresignPut(ctx context.Context, key, contentType string, expiry time.Duration) (*SignedUpload, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/storage/v1/object/upload/sign/%s/%s", s.baseURL, s.bucket, key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sign request: %w", err)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sign request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("sign failed: %s", string(body))
+	}
+
+	var signed struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return nil, fmt.Errorf("failed to decode sign response: %w", err)
+	}
+
+	headers := map[string]string{}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	return &SignedUpload{
+		URL:       s.baseURL + "/storage/v1" + signed.URL,
+		Method:    http.MethodPut,
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(supabaseSignedUploadTTL),
+	}, nil
+}
@@ -0,0 +1,148 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+)
+
+// DirectUpload is a drop whose video the client uploads straight to the
+// object store using a pre-signed URL. The upload is staged at StagingKey in
+// storage.Private until it is finalized. Its ID becomes the drop ID.
+type DirectUpload struct {
+	ID         uuid.UUID
+	UserID     string
+	StagingKey string
+	Caption    string
+	Visibility string
+	GroupID    *uuid.UUID
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+var directUploadTTL = 15 * time.Minute
+
+// InitDirect reads DIRECT_UPLOAD_TTL, the lifetime of pre-signed upload URLs
+func InitDirect() error {
+	if ttl := os.Getenv("DIRECT_UPLOAD_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("invalid DIRECT_UPLOAD_TTL: %w", err)
+		}
+		directUploadTTL = d
+	}
+	return nil
+}
+
+// DirectUploadTTL is how long a pre-signed upload URL should stay valid
+func DirectUploadTTL() time.Duration {
+	return directUploadTTL
+}
+
+// DirectStagingKey returns a new key to stage a direct upload at
+func DirectStagingKey() string {
+	return "direct/" + uuid.NewString()
+}
+
+// CreateDirectUpload reserves a drop ID and staging key for userID. expiresAt
+// is when the upload URL stops working, which some backends pick themselves.
+func CreateDirectUpload(ctx context.Context, userID, stagingKey, caption, visibility string, groupID *uuid.UUID, expiresAt time.Time) (*DirectUpload, error) {
+	u := &DirectUpload{
+		ID:         uuid.New(),
+		UserID:     userID,
+		StagingKey: stagingKey,
+		Caption:    caption,
+		Visibility: visibility,
+		GroupID:    groupID,
+		CreatedAt:  time.Now(),
+		ExpiresAt:  expiresAt,
+	}
+	_, err := db.DB.Exec(ctx, `
+		INSERT INTO direct_uploads (id, user_id, video_key, caption, visibility, group_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, u.ID, u.UserID, u.StagingKey, u.Caption, u.Visibility, u.GroupID, u.CreatedAt, u.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// GetDirectUpload loads a pending direct upload by ID. Expired uploads may
+// still be finalized until the cleanup job removes them, since the client
+// may have started its PUT just before the URL expired.
+func GetDirectUpload(ctx context.Context, id string) (*DirectUpload, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrUploadNotFound
+	}
+
+	var u DirectUpload
+	err = db.DB.QueryRow(ctx, `
+		SELECT id, user_id, video_key, caption, visibility, group_id, created_at, expires_at
+		FROM direct_uploads WHERE id = $1
+	`, uid).Scan(&u.ID, &u.UserID, &u.StagingKey, &u.Caption, &u.Visibility, &u.GroupID, &u.CreatedAt, &u.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ErrUploadClaimed is returned by Claim when another request already
+// finalized the upload
+var ErrUploadClaimed = errors.New("upload is already being finalized")
+
+// Claim removes the pending record as part of the transaction that creates
+// its drop, so only one finalize can succeed
+func (u *DirectUpload) Claim(ctx context.Context, e db.Execer) error {
+	tag, err := e.Exec(ctx, `DELETE FROM direct_uploads WHERE id = $1`, u.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUploadClaimed
+	}
+	return nil
+}
+
+// Delete removes the pending record once the drop exists
+func (u *DirectUpload) Delete(ctx context.Context) error {
+	_, err := db.DB.Exec(ctx, `DELETE FROM direct_uploads WHERE id = $1`, u.ID)
+	return err
+}
+
+// CleanupExpiredDirect removes direct uploads that were never finalized,
+// along with any object the client managed to upload
+func CleanupExpiredDirect(ctx context.Context) (int, error) {
+	// Grace period so an in-flight finalize is not raced
+	rows, err := db.DB.Query(ctx, `
+		DELETE FROM direct_uploads WHERE expires_at <= NOW() - INTERVAL '1 hour' RETURNING video_key
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return count, err
+		}
+		if err := storage.Private.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+			log.Println("Failed to delete abandoned upload", key, err)
+		}
+		count++
+	}
+	return count, rows.Err()
+}
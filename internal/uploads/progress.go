@@ -0,0 +1,118 @@
+package uploads
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// How long finished uploads stay queryable
+var finishedRetention = 5 * time.Minute
+
+// ErrUploadIDInUse is returned by Start for an ID the user is still uploading with
+var ErrUploadIDInUse = errors.New("upload ID is already in use")
+
+// Progress is a snapshot of an in-flight upload
+type Progress struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"-"`
+	BytesReceived int64     `json:"bytes_received"`
+	TotalBytes    int64     `json:"total_bytes"` // -1 when the client did not send a length
+	Done          bool      `json:"done"`
+	Error         string    `json:"error,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Tracker keeps progress for uploads handled by this process. Upload IDs are
+// chosen by clients, so entries are kept per user.
+type Tracker struct {
+	mu      sync.Mutex
+	uploads map[trackerKey]*Progress
+}
+
+type trackerKey struct {
+	userID, id string
+}
+
+// Default is the tracker used by the upload handlers
+var Default = NewTracker()
+
+func NewTracker() *Tracker {
+	return &Tracker{uploads: map[trackerKey]*Progress{}}
+}
+
+// Start registers a new upload for userID. An ID can be reused once its
+// previous upload has finished.
+func (t *Tracker) Start(userID, id string, total int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := trackerKey{userID, id}
+	if p, ok := t.uploads[key]; ok && !p.Done {
+		return ErrUploadIDInUse
+	}
+	t.uploads[key] = &Progress{ID: id, UserID: userID, TotalBytes: total, UpdatedAt: time.Now()}
+	return nil
+}
+
+// Add records n more bytes received for the user's upload id
+func (t *Tracker) Add(userID, id string, n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.uploads[trackerKey{userID, id}]; ok {
+		p.BytesReceived += n
+		p.UpdatedAt = time.Now()
+	}
+}
+
+// Finish marks the user's upload id as done and schedules its removal
+func (t *Tracker) Finish(userID, id string, err error) {
+	key := trackerKey{userID, id}
+	t.mu.Lock()
+	p, ok := t.uploads[key]
+	if ok {
+		p.Done = true
+		p.UpdatedAt = time.Now()
+		if err != nil {
+			p.Error = err.Error()
+		}
+	}
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	time.AfterFunc(finishedRetention, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		// The ID may have been reused by a newer upload since
+		if t.uploads[key] == p {
+			delete(t.uploads, key)
+		}
+	})
+}
+
+// Get returns a copy of the progress for the user's upload id
+func (t *Tracker) Get(userID, id string) (Progress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.uploads[trackerKey{userID, id}]
+	if !ok {
+		return Progress{}, false
+	}
+	return *p, true
+}
+
+// ProgressReader calls OnRead with the byte count of every successful read
+type ProgressReader struct {
+	R      io.Reader
+	OnRead func(n int64)
+}
+
+func (r *ProgressReader) Read(p []byte) (int, error) {
+	n, err := r.R.Read(p)
+	if n > 0 && r.OnRead != nil {
+		r.OnRead(int64(n))
+	}
+	return n, err
+}
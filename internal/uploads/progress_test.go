@@ -0,0 +1,60 @@
+package uploads
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTrackerStart(t *testing.T) {
+	tr := NewTracker()
+	if err := tr.Start("alice", "up-1", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Start("alice", "up-1", 100); err != ErrUploadIDInUse {
+		t.Fatalf("reusing an in-flight ID: err = %v, want ErrUploadIDInUse", err)
+	}
+
+	// Another user's upload with the same ID is separate
+	if err := tr.Start("mallory", "up-1", 5); err != nil {
+		t.Fatalf("same ID for another user: %v", err)
+	}
+	tr.Add("alice", "up-1", 40)
+	tr.Add("mallory", "up-1", 1)
+	if p, ok := tr.Get("alice", "up-1"); !ok || p.BytesReceived != 40 || p.TotalBytes != 100 {
+		t.Errorf("alice's progress = %+v, %v", p, ok)
+	}
+	if _, ok := tr.Get("bob", "up-1"); ok {
+		t.Error("bob can see an upload he didn't start")
+	}
+
+	// Finished IDs can be reused
+	tr.Finish("alice", "up-1", errors.New("boom"))
+	if p, _ := tr.Get("alice", "up-1"); !p.Done || p.Error != "boom" {
+		t.Errorf("finished progress = %+v", p)
+	}
+	if err := tr.Start("alice", "up-1", 200); err != nil {
+		t.Fatalf("reusing a finished ID: %v", err)
+	}
+}
+
+func TestTrackerCleanupKeepsReusedID(t *testing.T) {
+	old := finishedRetention
+	finishedRetention = 20 * time.Millisecond
+	defer func() { finishedRetention = old }()
+
+	tr := NewTracker()
+	_ = tr.Start("alice", "up-1", 10)
+	tr.Finish("alice", "up-1", nil)
+	_ = tr.Start("alice", "up-1", 20)
+	_ = tr.Start("alice", "up-2", 30)
+	tr.Finish("alice", "up-2", nil)
+
+	time.Sleep(100 * time.Millisecond)
+	if p, ok := tr.Get("alice", "up-1"); !ok || p.TotalBytes != 20 {
+		t.Errorf("cleanup of the first upload removed its replacement: %+v, %v", p, ok)
+	}
+	if _, ok := tr.Get("alice", "up-2"); ok {
+		t.Error("finished upload was not cleaned up")
+	}
+}
@@ -0,0 +1,372 @@
+package uploads
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/richiethie/BitDrop.Server/internal/db"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+)
+
+// ErrOffsetMismatch is returned when a chunk does not start at the current offset
+var ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+// ErrUploadNotFound is returned for unknown or expired resumable uploads
+var ErrUploadNotFound = errors.New("upload not found")
+
+// Resumable is a partially received upload. Its state lives in the
+// resumable_uploads table and the chunks received so far are staged in the
+// private object store, so any API instance can serve any request for it.
+type Resumable struct {
+	ID        uuid.UUID
+	UserID    string
+	Length    int64
+	Offset    int64
+	Metadata  map[string]string
+	DropID    *uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	// tx holds the row lock taken by Lock
+	tx pgx.Tx
+}
+
+var (
+	resumableDir = filepath.Join(os.TempDir(), "bitdrop_resumable")
+	resumableTTL = 24 * time.Hour
+)
+
+// InitResumable reads RESUMABLE_UPLOAD_DIR and RESUMABLE_UPLOAD_TTL and
+// prepares the scratch directory chunks are received and assembled in
+func InitResumable() error {
+	if dir := os.Getenv("RESUMABLE_UPLOAD_DIR"); dir != "" {
+		resumableDir = dir
+	}
+	if ttl := os.Getenv("RESUMABLE_UPLOAD_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("invalid RESUMABLE_UPLOAD_TTL: %w", err)
+		}
+		resumableTTL = d
+	}
+	return os.MkdirAll(resumableDir, 0o755)
+}
+
+// ResumableTTL is how long an upload may sit idle before it expires
+func ResumableTTL() time.Duration {
+	return resumableTTL
+}
+
+// chunkPrefix is where the chunks of upload id are staged
+func chunkPrefix(id uuid.UUID) string {
+	return "resumable/" + id.String() + "/"
+}
+
+// chunkKey names the chunk of upload id that starts at offset
+func chunkKey(id uuid.UUID, offset int64) string {
+	return fmt.Sprintf("%s%020d", chunkPrefix(id), offset)
+}
+
+// NewChunkFile creates a temporary file to receive a chunk into before it is
+// appended. The caller closes and removes it.
+func NewChunkFile() (*os.File, error) {
+	return os.CreateTemp(resumableDir, "chunk-*")
+}
+
+// Complete reports whether every byte has been received
+func (r *Resumable) Complete() bool {
+	return r.Offset == r.Length
+}
+
+// Lock reloads r's progress with its row locked, which serializes appends
+// to the upload across every API instance. Writes made while locked are
+// committed by the returned func, whose error the caller must check; calling
+// it again is a no-op. ErrUploadNotFound means the upload was terminated or
+// expired in the meantime.
+func (r *Resumable) Lock(ctx context.Context) (func() error, error) {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(ctx, `
+		SELECT upload_offset, drop_id, expires_at FROM resumable_uploads
+		WHERE id = $1 AND expires_at > NOW()
+		FOR UPDATE
+	`, r.ID).Scan(&r.Offset, &r.DropID, &r.ExpiresAt)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		if err == pgx.ErrNoRows {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+
+	r.tx = tx
+	return func() error {
+		if r.tx != tx {
+			return nil
+		}
+		r.tx = nil
+		if err := tx.Commit(context.Background()); err != nil {
+			return fmt.Errorf("failed to commit upload progress: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// conn is the transaction holding r's lock, or the pool when r isn't locked
+func (r *Resumable) conn() db.Execer {
+	if r.tx != nil {
+		return r.tx
+	}
+	return db.DB
+}
+
+// CreateResumable starts a new upload of length bytes owned by userID
+func CreateResumable(ctx context.Context, userID string, length int64, metadata map[string]string) (*Resumable, error) {
+	r := &Resumable{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(resumableTTL),
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.DB.Exec(ctx, `
+		INSERT INTO resumable_uploads (id, user_id, upload_length, upload_offset, metadata, created_at, expires_at)
+		VALUES ($1, $2, $3, 0, $4, $5, $6)
+	`, r.ID, r.UserID, r.Length, string(metadataJSON), r.CreatedAt, r.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetResumable loads an unexpired upload by ID
+func GetResumable(ctx context.Context, id string) (*Resumable, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrUploadNotFound
+	}
+
+	var r Resumable
+	var metadataJSON string
+	err = db.DB.QueryRow(ctx, `
+		SELECT id, user_id, upload_length, upload_offset, metadata, drop_id, created_at, expires_at
+		FROM resumable_uploads
+		WHERE id = $1 AND expires_at > NOW()
+	`, uid).Scan(&r.ID, &r.UserID, &r.Length, &r.Offset, &metadataJSON, &r.DropID, &r.CreatedAt, &r.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(metadataJSON), &r.Metadata); err != nil {
+		return nil, fmt.Errorf("invalid upload metadata: %w", err)
+	}
+	return &r, nil
+}
+
+// Append stages a chunk of size bytes starting at offset, which must equal
+// r.Offset. The caller must hold r.Lock().
+func (r *Resumable) Append(ctx context.Context, offset int64, chunk io.Reader, size int64) error {
+	if offset != r.Offset {
+		return ErrOffsetMismatch
+	}
+	if size > r.Length-offset {
+		return errors.New("chunk is longer than the rest of the upload")
+	}
+
+	if size > 0 {
+		err := storage.Private.Put(ctx, chunkKey(r.ID, offset), chunk, storage.PutOptions{
+			ContentType: "application/octet-stream",
+			Size:        size,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store upload chunk: %w", err)
+		}
+	}
+
+	expiresAt := time.Now().Add(resumableTTL)
+	_, err := r.conn().Exec(ctx, `
+		UPDATE resumable_uploads SET upload_offset = $2, expires_at = $3 WHERE id = $1
+	`, r.ID, offset+size, expiresAt)
+	if err != nil {
+		return err
+	}
+	r.Offset, r.ExpiresAt = offset+size, expiresAt
+	return nil
+}
+
+// Assemble joins the staged chunks into a temporary file and returns its
+// path. The caller removes the file.
+func (r *Resumable) Assemble(ctx context.Context) (string, error) {
+	objects, err := storage.Private.List(ctx, chunkPrefix(r.ID))
+	if err != nil {
+		return "", err
+	}
+	sizes := map[int64]int64{}
+	for _, obj := range objects {
+		if offset, err := strconv.ParseInt(path.Base(obj.Key), 10, 64); err == nil {
+			sizes[offset] = obj.Size
+		}
+	}
+
+	f, err := os.CreateTemp(resumableDir, "assembled-*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Following the offsets from 0 reads only the chunks the recorded offsets
+	// lead to. A chunk whose offset update failed is resent under the same key.
+	for offset := int64(0); offset < r.Length; {
+		size := sizes[offset]
+		if size <= 0 {
+			os.Remove(f.Name())
+			return "", fmt.Errorf("upload chunk at offset %d is missing", offset)
+		}
+		if err := appendObject(ctx, f, chunkKey(r.ID, offset), size); err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+		offset += size
+	}
+	return f.Name(), nil
+}
+
+// appendObject copies the size-byte object at key in the private store to w
+func appendObject(ctx context.Context, w io.Writer, key string, size int64) error {
+	body, err := storage.Private.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	n, err := io.Copy(w, body)
+	if err == nil && n != size {
+		err = fmt.Errorf("upload chunk %s is %d bytes, expected %d", key, n, size)
+	}
+	return err
+}
+
+// deleteChunks removes the staged chunks of upload id
+func deleteChunks(ctx context.Context, id uuid.UUID) {
+	if err := storage.DeletePrefix(ctx, storage.Private, chunkPrefix(id)); err != nil {
+		log.Printf("Failed to delete chunks of upload %s: %v", id, err)
+	}
+}
+
+// Claim records dropID as the drop created from the fully received upload r.
+// It runs in the transaction that inserts the drop, so only one request can
+// create a drop per upload, and the upload is only marked complete if the
+// drop exists.
+func (r *Resumable) Claim(ctx context.Context, e db.Execer, dropID uuid.UUID) error {
+	tag, err := e.Exec(ctx, `
+		UPDATE resumable_uploads SET drop_id = $2
+		WHERE id = $1 AND drop_id IS NULL AND upload_offset = upload_length
+	`, r.ID, dropID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUploadClaimed
+	}
+	return nil
+}
+
+// Finish notes the drop claimed for r once it's committed and drops the
+// staged chunks, which are no longer needed
+func (r *Resumable) Finish(ctx context.Context, dropID uuid.UUID) {
+	r.DropID = &dropID
+	deleteChunks(ctx, r.ID)
+}
+
+// Terminate deletes r and its received bytes. An append in progress holds
+// the row, so the delete waits for it to finish.
+func (r *Resumable) Terminate(ctx context.Context) error {
+	_, err := db.DB.Exec(ctx, `DELETE FROM resumable_uploads WHERE id = $1`, r.ID)
+	if err != nil {
+		return err
+	}
+	deleteChunks(ctx, r.ID)
+	return nil
+}
+
+// CleanupExpired removes every upload past its expiry along with its chunks.
+// Uploads locked by an in-flight request are left for the next run.
+func CleanupExpired(ctx context.Context) (int, error) {
+	rows, err := db.DB.Query(ctx, `
+		DELETE FROM resumable_uploads WHERE id IN (
+			SELECT id FROM resumable_uploads WHERE expires_at <= NOW() FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Chunks are deleted once the rows are gone, whichever instance staged them
+	for _, id := range ids {
+		deleteChunks(ctx, id)
+	}
+	return len(ids), nil
+}
+
+// StartCleanup runs CleanupExpired and CleanupExpiredDirect every interval
+// until ctx is cancelled
+func StartCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := CleanupExpired(ctx)
+				if err != nil {
+					log.Println("Failed to clean up expired uploads:", err)
+				} else if n > 0 {
+					log.Printf("Cleaned up %d expired uploads", n)
+				}
+				n, err = CleanupExpiredDirect(ctx)
+				if err != nil {
+					log.Println("Failed to clean up abandoned direct uploads:", err)
+				} else if n > 0 {
+					log.Printf("Cleaned up %d abandoned direct uploads", n)
+				}
+			}
+		}
+	}()
+}
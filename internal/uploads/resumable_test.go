@@ -0,0 +1,113 @@
+package uploads
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/richiethie/BitDrop.Server/internal/storage"
+)
+
+// usePrivateStore points storage.Private and the scratch directory at
+// temporary directories for the test
+func usePrivateStore(t *testing.T) {
+	t.Helper()
+	store, err := storage.NewPrivateLocalStore(t.TempDir(), "http://localhost", "test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevStore, prevDir := storage.Private, resumableDir
+	storage.Private, resumableDir = store, t.TempDir()
+	t.Cleanup(func() { storage.Private, resumableDir = prevStore, prevDir })
+}
+
+func putChunk(t *testing.T, id uuid.UUID, offset int64, data string) {
+	t.Helper()
+	err := storage.Private.Put(context.Background(), chunkKey(id, offset), strings.NewReader(data),
+		storage.PutOptions{Size: int64(len(data))})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  map[int64]string
+		length  int64
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "in order",
+			chunks: map[int64]string{0: "hello ", 6: "resumable ", 16: "world"},
+			length: 21,
+			want:   "hello resumable world",
+		},
+		{
+			name:   "chunk off the offset chain is ignored",
+			chunks: map[int64]string{0: "abc", 3: "def", 5: "stale-chunk", 6: "ghi"},
+			length: 9,
+			want:   "abcdefghi",
+		},
+		{
+			name:    "missing chunk",
+			chunks:  map[int64]string{0: "abc", 6: "ghi"},
+			length:  9,
+			wantErr: true,
+		},
+		{
+			name:    "short upload",
+			chunks:  map[int64]string{0: "abc"},
+			length:  9,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usePrivateStore(t)
+			r := &Resumable{ID: uuid.New(), Length: tt.length}
+			for offset, data := range tt.chunks {
+				putChunk(t, r.ID, offset, data)
+			}
+			// Chunks of other uploads are ignored
+			putChunk(t, uuid.New(), 0, "other upload")
+
+			path, err := r.Assemble(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					os.Remove(path)
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(path)
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("assembled %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendChecksOffset(t *testing.T) {
+	usePrivateStore(t)
+	r := &Resumable{ID: uuid.New(), Length: 10, Offset: 4}
+	if err := r.Append(context.Background(), 2, strings.NewReader("xx"), 2); err != ErrOffsetMismatch {
+		t.Errorf("err = %v, want ErrOffsetMismatch", err)
+	}
+	if err := r.Append(context.Background(), 4, strings.NewReader("too long"), 8); err == nil {
+		t.Error("a chunk past the upload length was accepted")
+	}
+	if objects, _ := storage.Private.List(context.Background(), chunkPrefix(r.ID)); len(objects) != 0 {
+		t.Errorf("rejected chunks were stored: %v", objects)
+	}
+}
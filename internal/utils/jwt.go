@@ -1,19 +1,49 @@
 package utils
 
 import (
+	"errors"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func GenerateJWT(userID string, email string) (string, error) {
+// AccessTokenTTL is the lifetime of access tokens (ACCESS_TOKEN_TTL, default 15 minutes).
+// Clients renew them with a refresh token.
+func AccessTokenTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 15 * time.Minute
+}
+
+// JWTIssuer is the iss claim of our access tokens (JWT_ISSUER, default "bitdrop")
+func JWTIssuer() string {
+	if iss := os.Getenv("JWT_ISSUER"); iss != "" {
+		return iss
+	}
+	return "bitdrop"
+}
+
+// GenerateJWT issues an access token for a user's session. The session ID goes
+// in the `sid` claim so revoked sessions can be rejected before the token expires.
+func GenerateJWT(userID string, email string, sessionID string) (string, error) {
+	if activeKey == nil {
+		return "", errors.New("JWT keys not initialized")
+	}
+
+	now := time.Now()
 	claims := jwt.MapClaims{
+		"iss":     JWTIssuer(),
+		"sub":     userID,
 		"user_id": userID,
 		"email":   email,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(), // 3 days
+		"sid":     sessionID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(AccessTokenTTL()).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("SUPABASE_JWT_SECRET")))
+	token := jwt.NewWithClaims(activeKey.method, claims)
+	token.Header["kid"] = activeKey.kid
+	return token.SignedString(activeKey.private)
 }
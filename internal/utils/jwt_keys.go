@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/richiethie/BitDrop.Server/internal/oidc"
+)
+
+// jwtKey is one of our own token keys. Verify-only keys have no private half.
+type jwtKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+	jwk     oidc.JWK
+}
+
+var (
+	activeKey    *jwtKey
+	verifyKeys   = map[string]*jwtKey{}
+	supabaseKeys *oidc.KeySet
+)
+
+// ErrUnknownSigningKey is returned for tokens signed by a key we don't trust
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// InitJWTKeys loads the keys access tokens are signed and verified with.
+//
+// JWT_SIGNING_KEY_FILE is the PEM private key (RSA or Ed25519) new tokens are
+// signed with. JWT_VERIFY_KEY_FILES is a comma-separated list of extra PEM
+// keys that are still accepted and published in the JWKS. To rotate, add the
+// new key to JWT_VERIFY_KEY_FILES and deploy, then make it the signing key
+// with the old one in JWT_VERIFY_KEY_FILES, and drop the old one once
+// ACCESS_TOKEN_TTL has passed.
+//
+// Supabase tokens are verified against SUPABASE_JWKS_URL (derived from
+// SUPABASE_URL by default), or SUPABASE_JWT_SECRET for legacy HS256 projects.
+func InitJWTKeys() error {
+	activeKey = nil
+	verifyKeys = map[string]*jwtKey{}
+
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		key, err := loadJWTKey(path)
+		if err != nil {
+			return fmt.Errorf("failed to load JWT signing key: %w", err)
+		}
+		if key.private == nil {
+			return fmt.Errorf("JWT_SIGNING_KEY_FILE must contain a private key")
+		}
+		activeKey = key
+	} else {
+		// Tokens won't survive a restart or work across instances, fine for local dev
+		log.Println("⚠️ JWT_SIGNING_KEY_FILE not set, using a temporary signing key")
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		activeKey, err = newJWTKey(priv)
+		if err != nil {
+			return err
+		}
+	}
+	verifyKeys[activeKey.kid] = activeKey
+
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFY_KEY_FILES"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		key, err := loadJWTKey(path)
+		if err != nil {
+			return fmt.Errorf("failed to load JWT verification key %s: %w", path, err)
+		}
+		verifyKeys[key.kid] = key
+	}
+
+	jwksURL := os.Getenv("SUPABASE_JWKS_URL")
+	if jwksURL == "" && os.Getenv("SUPABASE_URL") != "" {
+		jwksURL = strings.TrimRight(os.Getenv("SUPABASE_URL"), "/") + "/auth/v1/.well-known/jwks.json"
+	}
+	supabaseKeys = nil
+	if jwksURL != "" {
+		supabaseKeys = oidc.NewKeySet(jwksURL)
+	}
+
+	fmt.Printf("🔐 Signing access tokens with %s key %s (%d verification keys)\n", activeKey.method.Alg(), activeKey.kid, len(verifyKeys))
+	return nil
+}
+
+// loadJWTKey reads a PEM private or public key
+func loadJWTKey(path string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newJWTKey(priv)
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newJWTKey(priv)
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newJWTKey(pub)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// newJWTKey wraps an RSA or Ed25519 private or public key
+func newJWTKey(key any) (*jwtKey, error) {
+	k := &jwtKey{}
+	if signer, ok := key.(crypto.Signer); ok {
+		k.private = signer
+		key = signer.Public()
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		k.method = jwt.SigningMethodRS256
+		k.public = pub
+		k.jwk = oidc.JWK{Kty: "RSA", N: enc(pub.N.Bytes()), E: enc(big.NewInt(int64(pub.E)).Bytes())}
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+		k.public = pub
+		k.jwk = oidc.JWK{Kty: "OKP", Crv: "Ed25519", X: enc(pub)}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", key)
+	}
+
+	k.kid = jwkThumbprint(k.jwk)
+	k.jwk.Kid = k.kid
+	k.jwk.Use = "sig"
+	k.jwk.Alg = k.method.Alg()
+	return k, nil
+}
+
+// jwkThumbprint is the RFC 7638 thumbprint of a public key, used as its kid
+func jwkThumbprint(k oidc.JWK) string {
+	var members []byte
+	switch k.Kty {
+	case "RSA":
+		members, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N})
+	case "OKP":
+		members, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X})
+	}
+	sum := sha256.Sum256(members)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS returns our public verification keys as a JSON Web Key Set
+func JWKS() map[string][]oidc.JWK {
+	keys := make([]oidc.JWK, 0, len(verifyKeys))
+	if activeKey != nil {
+		keys = append(keys, activeKey.jwk)
+	}
+	for kid, k := range verifyKeys {
+		if activeKey == nil || kid != activeKey.kid {
+			keys = append(keys, k.jwk)
+		}
+	}
+	return map[string][]oidc.JWK{"keys": keys}
+}
+
+// ParseJWT verifies an access token, either one of ours or one issued by
+// Supabase, and returns its claims
+func ParseJWT(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	methods := []string{"RS256", "EdDSA", "ES256"}
+	supabaseSecret := os.Getenv("SUPABASE_JWT_SECRET")
+	if supabaseSecret != "" {
+		methods = append(methods, "HS256")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if k, ok := verifyKeys[kid]; ok {
+			if t.Method.Alg() != k.method.Alg() {
+				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			}
+			return k.public, nil
+		}
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			return []byte(supabaseSecret), nil
+		}
+		if supabaseKeys != nil {
+			return supabaseKeys.Key(ctx, kid)
+		}
+		return nil, ErrUnknownSigningKey
+	}, jwt.WithValidMethods(methods), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/richiethie/BitDrop.Server/internal/oidc"
+)
+
+// useTestKeys makes a fresh Ed25519 key the signing key and an RSA key a
+// verify-only key, as during a rotation. It returns the RSA key.
+func useTestKeys(t *testing.T) *jwtKey {
+	t.Helper()
+	prevActive, prevVerify, prevSupabase := activeKey, verifyKeys, supabaseKeys
+	t.Cleanup(func() { activeKey, verifyKeys, supabaseKeys = prevActive, prevVerify, prevSupabase })
+
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activeKey, err = newJWTKey(edPriv); err != nil {
+		t.Fatal(err)
+	}
+	old, err := newJWTKey(rsaPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyKeys = map[string]*jwtKey{activeKey.kid: activeKey, old.kid: old}
+	supabaseKeys = nil
+	return old
+}
+
+func accessClaims(exp time.Time) jwt.MapClaims {
+	return jwt.MapClaims{"iss": "bitdrop", "sub": "user-1", "sid": "session-1", "exp": exp.Unix()}
+}
+
+func signWith(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestGenerateAndParseJWT(t *testing.T) {
+	useTestKeys(t)
+	raw, err := GenerateJWT("user-1", "a@example.com", "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(raw, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != activeKey.kid || token.Header["alg"] != "EdDSA" {
+		t.Errorf("header = %v, want kid %s and EdDSA", token.Header, activeKey.kid)
+	}
+
+	claims, err := ParseJWT(context.Background(), raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "user-1" || claims["sid"] != "session-1" || claims["iss"] != JWTIssuer() {
+		t.Errorf("claims = %v", claims)
+	}
+}
+
+func TestParseJWT(t *testing.T) {
+	old := useTestKeys(t)
+	t.Setenv("SUPABASE_JWT_SECRET", "")
+	valid := accessClaims(time.Now().Add(time.Minute))
+
+	_, stranger, _ := ed25519.GenerateKey(rand.Reader)
+	rsaPublicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPKIX(t, old.public)})
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"active key", signWith(t, jwt.SigningMethodEdDSA, activeKey.kid, activeKey.private, valid), true},
+		{"verify-only key from a rotation", signWith(t, jwt.SigningMethodRS256, old.kid, old.private, valid), true},
+		{"unknown key claiming our kid", signWith(t, jwt.SigningMethodEdDSA, activeKey.kid, stranger, valid), false},
+		{"unknown kid", signWith(t, jwt.SigningMethodEdDSA, "someone-else", stranger, valid), false},
+		{"no kid", signWith(t, jwt.SigningMethodEdDSA, "", activeKey.private, valid), false},
+		{"alg differs from the kid's key", signWith(t, jwt.SigningMethodRS256, activeKey.kid, old.private, valid), false},
+		{"HS256 keyed with our RSA public key", signWith(t, jwt.SigningMethodHS256, old.kid, rsaPublicPEM, valid), false},
+		{"HS256 with an empty secret", signWith(t, jwt.SigningMethodHS256, "", []byte(""), valid), false},
+		{"alg none", unsigned, false},
+		{"expired", signWith(t, jwt.SigningMethodEdDSA, activeKey.kid, activeKey.private, accessClaims(time.Now().Add(-time.Minute))), false},
+		{"no expiry", signWith(t, jwt.SigningMethodEdDSA, activeKey.kid, activeKey.private, jwt.MapClaims{"sub": "user-1"}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJWT(context.Background(), tt.token)
+			if tt.ok && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
+
+func TestParseJWTUnknownKid(t *testing.T) {
+	useTestKeys(t)
+	_, stranger, _ := ed25519.GenerateKey(rand.Reader)
+	raw := signWith(t, jwt.SigningMethodEdDSA, "someone-else", stranger, accessClaims(time.Now().Add(time.Minute)))
+	if _, err := ParseJWT(context.Background(), raw); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("err = %v, want ErrUnknownSigningKey", err)
+	}
+}
+
+func TestParseJWTSupabaseSecret(t *testing.T) {
+	useTestKeys(t)
+	t.Setenv("SUPABASE_JWT_SECRET", "legacy-secret")
+	valid := accessClaims(time.Now().Add(time.Minute))
+
+	if _, err := ParseJWT(context.Background(), signWith(t, jwt.SigningMethodHS256, "", []byte("legacy-secret"), valid)); err != nil {
+		t.Errorf("legacy Supabase token rejected: %v", err)
+	}
+	if _, err := ParseJWT(context.Background(), signWith(t, jwt.SigningMethodHS256, "", []byte("guessed"), valid)); err == nil {
+		t.Error("token with the wrong secret accepted")
+	}
+}
+
+func TestLoadJWTKey(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(edPriv)
+
+	tests := []struct {
+		name        string
+		block       *pem.Block
+		wantAlg     string
+		wantPrivate bool
+		wantErr     bool
+	}{
+		{"PKCS#1 RSA", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaPriv)}, "RS256", true, false},
+		{"PKCS#8 Ed25519", &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}, "EdDSA", true, false},
+		{"public Ed25519", &pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPKIX(t, edPub)}, "EdDSA", false, false},
+		{"RSA under 2048 bits", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weak)}, "", false, true},
+		{"certificate", &pem.Block{Type: "CERTIFICATE", Bytes: []byte("x")}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "key.pem")
+			if err := os.WriteFile(path, pem.EncodeToMemory(tt.block), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			k, err := loadJWTKey(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.method.Alg() != tt.wantAlg || (k.private != nil) != tt.wantPrivate {
+				t.Errorf("key = %s private=%v, want %s private=%v", k.method.Alg(), k.private != nil, tt.wantAlg, tt.wantPrivate)
+			}
+			if k.jwk.Kid != k.kid || k.jwk.Alg != tt.wantAlg {
+				t.Errorf("jwk = %+v", k.jwk)
+			}
+		})
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// Example from RFC 7638 section 3.1
+	k := oidc.JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMs" +
+			"tn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91" +
+			"CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	if got, want := jwkThumbprint(k), "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("thumbprint = %s, want %s", got, want)
+	}
+}
+
+func mustMarshalPKIX(t *testing.T, pub any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
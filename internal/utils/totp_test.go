@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// base32 of the ASCII secret "12345678901234567890" from RFC 6238 appendix B
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 SHA-1 test vectors, truncated to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, tt.unix/totpPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+	if got, _ := TOTPCode(strings.ToLower(rfcSecret), 1); got == "" {
+		t.Error("lowercase secrets should decode")
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	code := func(s int64) string {
+		c, err := TOTPCode(rfcSecret, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantOK   bool
+		wantStep int64
+	}{
+		{"current step", code(step), true, step},
+		{"previous step", code(step - 1), true, step - 1},
+		{"next step", code(step + 1), true, step + 1},
+		{"two steps ago", code(step - 2), false, 0},
+		{"two steps ahead", code(step + 2), false, 0},
+		{"spaces", " " + code(step)[:3] + " " + code(step)[3:] + " ", true, step},
+		{"too short", code(step)[:5], false, 0},
+		{"too long", code(step) + "0", false, 0},
+		{"empty", "", false, 0},
+		{"wrong", "000000", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateTOTP(rfcSecret, tt.code, now)
+			if ok != tt.wantOK || got != tt.wantStep {
+				t.Errorf("ValidateTOTP = %d, %v, want %d, %v", got, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	a, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateTOTPSecret()
+	if a == b || len(a) != 32 {
+		t.Errorf("secrets %q and %q", a, b)
+	}
+	if _, err := TOTPCode(a, 1); err != nil {
+		t.Errorf("generated secret doesn't decode: %v", err)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	u, err := url.Parse(TOTPURI("BitDrop", "alice@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/BitDrop:alice@example.com" {
+		t.Errorf("URI = %s", u)
+	}
+	q := u.Query()
+	if q.Get("secret") != rfcSecret || q.Get("issuer") != "BitDrop" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("query = %v", q)
+	}
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// APIURL builds an absolute link to this API (API_BASE_URL, default
+// http://localhost:$PORT), for URLs used outside API responses' own origin
+// such as emailed links and media URLs
+func APIURL(path string) string {
+	base := strings.TrimRight(os.Getenv("API_BASE_URL"), "/")
+	if base == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		base = "http://localhost:" + port
+	}
+	return base + path
+}
@@ -0,0 +1,9 @@
+-- Persist object store keys on drops instead of deriving them from public URLs
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS video_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS thumbnail_key TEXT NOT NULL DEFAULT '';
+
+-- Backfill keys for drops uploaded to the Supabase 'drops' bucket
+UPDATE drops SET video_key = substring(video_url FROM '/drops/(.*)$')
+WHERE video_key = '' AND video_url LIKE '%/drops/%';
+UPDATE drops SET thumbnail_key = substring(thumbnail FROM '/drops/(.*)$')
+WHERE thumbnail_key = '' AND thumbnail LIKE '%/drops/%';
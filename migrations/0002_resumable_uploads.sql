@@ -0,0 +1,13 @@
+-- Partially received tus uploads; the chunks live in the private object store
+CREATE TABLE IF NOT EXISTS resumable_uploads (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    drop_id UUID REFERENCES drops(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS resumable_uploads_expires_at_idx ON resumable_uploads (expires_at);
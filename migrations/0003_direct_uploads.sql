@@ -0,0 +1,12 @@
+-- Drops reserved for a pre-signed direct-to-storage upload, awaiting finalize
+CREATE TABLE IF NOT EXISTS direct_uploads (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    video_key TEXT NOT NULL,
+    caption TEXT NOT NULL DEFAULT '',
+    group_id UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS direct_uploads_expires_at_idx ON direct_uploads (expires_at);
@@ -0,0 +1,20 @@
+-- Durable background job queue consumed by cmd/worker
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMPTZ,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS jobs_runnable_idx ON jobs (run_at) WHERE status IN ('pending', 'running');
+
+-- Media processing status for drops; existing drops were processed inline
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'ready'
+    CHECK (status IN ('processing', 'ready', 'failed'));
@@ -0,0 +1,3 @@
+-- HLS master playlist produced by the transcode_drop job
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS playlist_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS playlist_key TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- Video metadata captured with ffprobe at upload time
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS duration DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS width INT NOT NULL DEFAULT 0;
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS height INT NOT NULL DEFAULT 0;
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS codec TEXT NOT NULL DEFAULT '';
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS fps DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS rotation INT NOT NULL DEFAULT 0;
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS file_size BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- Thumbnail candidates and animated preview produced by the process_drop job
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS thumbnail_candidates TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS thumbnail_candidate_keys TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS preview_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS preview_key TEXT NOT NULL DEFAULT '';
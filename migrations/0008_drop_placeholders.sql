@@ -0,0 +1,3 @@
+-- BlurHash and dominant colour of the drop thumbnail, for instant placeholders
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS blurhash TEXT NOT NULL DEFAULT '';
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS dominant_color TEXT NOT NULL DEFAULT '';
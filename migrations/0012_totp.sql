@@ -0,0 +1,21 @@
+-- TOTP two-factor authentication. A row without enabled_at is a pending enrollment.
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    enabled_at TIMESTAMPTZ,
+    last_used_step BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS totp_recovery_codes_user_id_idx ON totp_recovery_codes (user_id);
+
+-- Wrong codes entered against a login challenge
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
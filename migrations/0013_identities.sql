@@ -0,0 +1,29 @@
+-- External login identities (OIDC providers) linked to users, plus pending
+-- authorization code flows
+CREATE TABLE IF NOT EXISTS identities (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS identities_user_id_idx ON identities (user_id);
+
+CREATE TABLE IF NOT EXISTS oidc_states (
+    id UUID PRIMARY KEY,
+    state_hash TEXT NOT NULL UNIQUE,
+    provider TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    device_name TEXT NOT NULL DEFAULT '',
+    link_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Social-only accounts have no password
+ALTER TABLE users ALTER COLUMN password DROP NOT NULL;
@@ -0,0 +1,19 @@
+-- Failed login counters keyed by "account:<email>" or "ip:<address>", shared
+-- by all API instances, and an audit trail of the lockouts they caused
+CREATE TABLE IF NOT EXISTS login_throttles (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    id UUID PRIMARY KEY,
+    key TEXT NOT NULL,
+    failures INT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    locked_until TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS login_lockouts_key_idx ON login_lockouts (key, created_at);
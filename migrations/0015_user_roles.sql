@@ -0,0 +1,16 @@
+-- Role assignments. A NULL group_id is a global role, otherwise the role only
+-- applies to that group's resources. Permissions per role are defined in code.
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    group_id UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_roles_unique_idx
+    ON user_roles (user_id, role, COALESCE(group_id, '00000000-0000-0000-0000-000000000000'));
+
+-- Existing admins keep their access
+INSERT INTO user_roles (user_id, role, group_id, created_at)
+SELECT id, 'admin', NULL, NOW() FROM users WHERE is_admin
+ON CONFLICT DO NOTHING;
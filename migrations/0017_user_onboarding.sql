@@ -0,0 +1,5 @@
+-- Auto-provisioned users start with a generated username and are prompted to pick one
+ALTER TABLE users ADD COLUMN IF NOT EXISTS needs_onboarding BOOLEAN NOT NULL DEFAULT false;
+
+-- Earlier provisioning gave everyone "newuser"; let them choose a real handle
+UPDATE users SET needs_onboarding = true WHERE username = 'newuser';
@@ -0,0 +1,18 @@
+-- Accounts scheduled for deletion stay restorable until deletion_scheduled_at,
+-- when a job hard-deletes them
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMPTZ;
+
+-- ZIP exports of a user's data. Only the SHA-256 of the download token is stored.
+CREATE TABLE IF NOT EXISTS account_exports (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending',
+    object_key TEXT NOT NULL DEFAULT '',
+    size BIGINT NOT NULL DEFAULT 0,
+    token_hash TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS account_exports_user_id_idx ON account_exports (user_id);
@@ -0,0 +1,16 @@
+-- Editable profile fields and the stored images behind avatar_url
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_keys TEXT[] NOT NULL DEFAULT '{}';
+
+-- Every username change, for the change cooldown and for finding people by
+-- a name they used to have
+CREATE TABLE IF NOT EXISTS username_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_username TEXT NOT NULL,
+    new_username TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS username_history_user_id_idx ON username_history (user_id, changed_at);
+CREATE INDEX IF NOT EXISTS username_history_old_username_idx ON username_history (LOWER(old_username));
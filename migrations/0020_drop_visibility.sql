@@ -0,0 +1,18 @@
+-- Drops are "private", "public" or "shared". Shared drops are visible to
+-- the users on their share list.
+UPDATE drops SET visibility = 'public' WHERE visibility IS NULL OR visibility NOT IN ('private', 'public', 'shared');
+ALTER TABLE drops ALTER COLUMN visibility SET DEFAULT 'public';
+ALTER TABLE drops ALTER COLUMN visibility SET NOT NULL;
+
+CREATE TABLE IF NOT EXISTS drop_shares (
+    drop_id UUID NOT NULL REFERENCES drops(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (drop_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS drop_shares_user_id_idx ON drop_shares (user_id);
+CREATE INDEX IF NOT EXISTS drops_user_id_visibility_idx ON drops (user_id, visibility, created_at DESC);
+
+-- Visibility chosen when a direct upload URL is requested, applied on finalize
+ALTER TABLE direct_uploads ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'public';
@@ -0,0 +1,13 @@
+-- Whether a drop's media lives in the private bucket, where it's only
+-- reachable through signed URLs. Set for non-public drops.
+ALTER TABLE drops ADD COLUMN IF NOT EXISTS media_private BOOLEAN NOT NULL DEFAULT false;
+
+-- Move the media of existing non-public drops out of the public bucket
+INSERT INTO jobs (kind, payload)
+SELECT 'move_drop_media', json_build_object('drop_id', id)
+FROM drops
+WHERE visibility <> 'public' AND NOT media_private
+  AND NOT EXISTS (
+      SELECT 1 FROM jobs j
+      WHERE j.kind = 'move_drop_media' AND j.payload->>'drop_id' = drops.id::text AND j.status IN ('pending', 'running')
+  );
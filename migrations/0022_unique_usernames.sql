@@ -0,0 +1,13 @@
+-- Usernames are unique regardless of case. Earlier provisioning handed out
+-- duplicates (mostly "newuser"): every holder of a name but the oldest gets a
+-- suffixed one and is asked to pick a new handle.
+UPDATE users u
+SET username = LOWER(LEFT(u.username, 21)) || '_' || LEFT(REPLACE(u.id::text, '-', ''), 8),
+    needs_onboarding = true
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY LOWER(username) ORDER BY created_at, id) AS n
+    FROM users
+) dup
+WHERE dup.id = u.id AND dup.n > 1;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (LOWER(username));
@@ -0,0 +1,5 @@
+-- Completing a resumable upload records its drop_id before inserting the
+-- drop, in the same transaction, so the check waits for the commit
+ALTER TABLE resumable_uploads DROP CONSTRAINT IF EXISTS resumable_uploads_drop_id_fkey;
+ALTER TABLE resumable_uploads ADD CONSTRAINT resumable_uploads_drop_id_fkey
+    FOREIGN KEY (drop_id) REFERENCES drops(id) ON DELETE SET NULL DEFERRABLE INITIALLY DEFERRED;
@@ -0,0 +1,2 @@
+-- Profiles are no longer looked up by a username someone changed away from
+DROP INDEX IF EXISTS username_history_old_username_idx;